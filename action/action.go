@@ -1,5 +1,92 @@
 package action
 
-type Action interface {
-	Execute()
+import (
+	"bytes"
+	"context"
+)
+
+// Runner runs the commands of states. Run returns the combined output
+// of the command, and an error if it could not run or exited non-zero.
+// A command must stop when ctx is done.
+type Runner interface {
+	Run(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+type runnerKey struct{}
+
+type outputKey struct{}
+
+type rootKey struct{}
+
+// WithRunner returns a context carrying r, which states use to run
+// their commands.
+func WithRunner(ctx context.Context, r Runner) context.Context {
+	return context.WithValue(ctx, runnerKey{}, r)
+}
+
+// FromContext returns the runner carried by ctx, or a Shell with the
+// default grace period if there is none.
+func FromContext(ctx context.Context) Runner {
+	if r, ok := ctx.Value(runnerKey{}).(Runner); ok {
+		return r
+	}
+	return NewShell()
+}
+
+// WithOutput returns a context carrying fn, which runners call with
+// every line a command prints, as it is printed.
+func WithOutput(ctx context.Context, fn func(line string)) context.Context {
+	return context.WithValue(ctx, outputKey{}, fn)
+}
+
+// OutputFrom returns the output function carried by ctx, or nil
+func OutputFrom(ctx context.Context) func(line string) {
+	fn, _ := ctx.Value(outputKey{}).(func(line string))
+	return fn
+}
+
+// LineWriter calls a function with every complete line written to
+// it. It is not safe for concurrent use.
+type LineWriter struct {
+	fn  func(line string)
+	buf []byte
+}
+
+// NewLineWriter returns a LineWriter calling fn
+func NewLineWriter(fn func(line string)) *LineWriter {
+	return &LineWriter{fn: fn}
+}
+
+func (l *LineWriter) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		l.fn(string(l.buf[:i]))
+		l.buf = l.buf[i+1:]
+	}
+}
+
+// Flush calls fn with the last line, if it did not end in a newline
+func (l *LineWriter) Flush() {
+	if len(l.buf) > 0 {
+		l.fn(string(l.buf))
+		l.buf = nil
+	}
+}
+
+// WithRoot returns a context carrying the root directory of the system
+// states manage, for states that read and write files.
+func WithRoot(ctx context.Context, root string) context.Context {
+	return context.WithValue(ctx, rootKey{}, root)
+}
+
+// RootFrom returns the root carried by ctx, or / if there is none
+func RootFrom(ctx context.Context) string {
+	if root, ok := ctx.Value(rootKey{}).(string); ok {
+		return root
+	}
+	return "/"
 }
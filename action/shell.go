@@ -1,15 +1,128 @@
 package action
 
-// Shell action runs a set of commands on the shell
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultGrace is how long a command is given to exit after it is
+// asked to stop, before it is killed.
+const DefaultGrace = 10 * time.Second
+
+// chrootPath is where commands are looked up in an alternate root
+const chrootPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// Shell runs commands directly on the host. Each command runs in its
+// own process group, so that stopping it also stops any children it
+// started.
 type Shell struct {
-	Action
-	commands []string
+	// Grace is how long a command may take to exit after SIGTERM,
+	// once its context is done, before it is sent SIGKILL.
+	Grace time.Duration
+
+	// Root, when set, is the directory commands are chrooted into,
+	// such as the root filesystem of an image being built. Commands
+	// are then looked up in the root rather than on the host.
+	Root string
 }
 
+// NewShell returns a Shell with the default grace period
 func NewShell() *Shell {
-	return &Shell{}
+	return &Shell{Grace: DefaultGrace}
 }
 
-func (s *Shell) Execute() {
+// Run runs the command and returns its combined output. When ctx is
+// done the command's process group is terminated, and the error
+// returned is the context's.
+func (s *Shell) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cmd, err := s.command(name, args)
+	if err != nil {
+		return nil, err
+	}
+	// Sharing one writer makes exec copy both streams in one goroutine
+	out := &bytes.Buffer{}
+	var w io.Writer = out
+	if fn := OutputFrom(ctx); fn != nil {
+		lines := NewLineWriter(fn)
+		defer lines.Flush()
+		w = io.MultiWriter(out, lines)
+	}
+	cmd.Stdout = w
+	cmd.Stderr = w
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		return out.Bytes(), err
+	case <-ctx.Done():
+	}
+
+	// Ask the whole group to stop, and kill it if it takes too long
+	pgid := -cmd.Process.Pid
+	syscall.Kill(pgid, syscall.SIGTERM)
+	select {
+	case <-done:
+	case <-time.After(s.Grace):
+		syscall.Kill(pgid, syscall.SIGKILL)
+		<-done
+	}
+	return out.Bytes(), fmt.Errorf("%s: %w", name, ctx.Err())
+}
+
+// command returns the command to run, chrooted into Root if it is set
+func (s *Shell) command(name string, args []string) (*exec.Cmd, error) {
+	if s.Root == "" || filepath.Clean(s.Root) == "/" {
+		cmd := exec.Command(name, args...)
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		return cmd, nil
+	}
+	path, err := lookPath(s.Root, name)
+	if err != nil {
+		return nil, err
+	}
+	// The working directory is changed after the chroot, so that the
+	// command does not start outside of it.
+	cmd := &exec.Cmd{
+		Path: path,
+		Args: append([]string{name}, args...),
+		Env:  append(os.Environ(), "PATH="+chrootPath),
+		Dir:  "/",
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Chroot: s.Root}
+	return cmd, nil
+}
 
+// lookPath finds the executable name in root, and returns its path
+// within root. Symbolic links are taken as they are, since they may
+// only resolve once chrooted.
+func lookPath(root, name string) (string, error) {
+	if strings.Contains(name, "/") {
+		return name, nil
+	}
+	for _, dir := range filepath.SplitList(chrootPath) {
+		path := filepath.Join(dir, name)
+		fi, err := os.Lstat(filepath.Join(root, path))
+		if err != nil {
+			continue
+		}
+		if fi.Mode()&os.ModeSymlink != 0 || (fi.Mode().IsRegular() && fi.Mode()&0111 != 0) {
+			return path, nil
+		}
+	}
+	return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
 }
@@ -0,0 +1,75 @@
+package action
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellRun(t *testing.T) {
+	s := NewShell()
+	out, err := s.Run(context.Background(), "sh", "-c", "echo out; echo err >&2")
+	assert.Nil(t, err)
+	assert.Equal(t, "out\nerr\n", string(out))
+
+	_, err = s.Run(context.Background(), "false")
+	assert.Error(t, err)
+}
+
+func TestShellRunCancel(t *testing.T) {
+	s := &Shell{Grace: 50 * time.Millisecond}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	// The shell ignores SIGTERM, so its children are killed after the
+	// grace period.
+	started := time.Now()
+	_, err := s.Run(ctx, "sh", "-c", "trap '' TERM; sleep 5; sleep 5")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.True(t, time.Since(started) < 2*time.Second)
+}
+
+func TestShellRunOutput(t *testing.T) {
+	var lines []string
+	ctx := WithOutput(context.Background(), func(line string) {
+		lines = append(lines, line)
+	})
+	out, err := NewShell().Run(ctx, "printf", "one\ntwo\nthree")
+	assert.Nil(t, err)
+	assert.Equal(t, "one\ntwo\nthree", string(out))
+	assert.Equal(t, []string{"one", "two", "three"}, lines)
+}
+
+func TestLookPath(t *testing.T) {
+	root, err := ioutil.TempDir("", "root")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "usr/bin"), 0755))
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "bin"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(root, "usr/bin/tool"), nil, 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(root, "bin/data"), nil, 0644))
+	assert.Nil(t, os.Symlink("/etc/alternatives/editor", filepath.Join(root, "usr/bin/editor")))
+
+	var tests = []struct {
+		name string
+		path string
+	}{
+		{"tool", "/usr/bin/tool"},
+		{"editor", "/usr/bin/editor"},
+		{"/opt/tool", "/opt/tool"},
+		{"data", ""},
+		{"missing", ""},
+	}
+	for _, test := range tests {
+		path, err := lookPath(root, test.name)
+		assert.Equal(t, test.path, path, test.name)
+		assert.Equal(t, test.path == "", errors.Is(err, exec.ErrNotFound), test.name)
+	}
+}
@@ -0,0 +1,253 @@
+/*
+Package address parses and matches the addresses used to refer to
+states, e.g. apt.install.base_system.
+*/
+package address
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// NoIndex is the index of an address that does not have one
+const NoIndex = -1
+
+var (
+	// ErrEmpty is returned when parsing an empty address
+	ErrEmpty = errors.New("address: empty address")
+
+	identRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+	indexRe = regexp.MustCompile(`^(.+)\[([0-9]+)\]$`)
+)
+
+// Address identifies a single state. States declared inside a module
+// are prefixed with module.<name>., and an index distinguishes the
+// instances of a state that expands to many, e.g. name[0].
+type Address struct {
+	Module  []string
+	Type    string
+	Command string
+	Name    string
+	Index   int
+}
+
+// New returns the address of a top level state without an index
+func New(typ, command, name string) Address {
+	return Address{Type: typ, Command: command, Name: name, Index: NoIndex}
+}
+
+// Parse parses an address of the form
+// [module.<name>.]...type.command.name[index]. The type and command
+// are identifiers, while the name is everything after the command and
+// may itself contain dots.
+func Parse(s string) (Address, error) {
+	a := Address{Index: NoIndex}
+	if s == "" {
+		return a, ErrEmpty
+	}
+
+	var rest string
+	var err error
+	a.Module, rest, err = parseModule(s)
+	if err != nil {
+		return a, err
+	}
+
+	parts := strings.SplitN(rest, ".", 3)
+	if len(parts) != 3 {
+		return a, fmt.Errorf("address: %q must be of the form type.command.name", s)
+	}
+	a.Type, a.Command, a.Name = parts[0], parts[1], parts[2]
+
+	if m := indexRe.FindStringSubmatch(a.Name); m != nil {
+		a.Name = m[1]
+		a.Index, _ = strconv.Atoi(m[2])
+	}
+
+	if err := a.Validate(); err != nil {
+		return a, fmt.Errorf("address: %q: %s", s, err)
+	}
+	return a, nil
+}
+
+// parseModule strips any module.<name>. prefixes from s
+func parseModule(s string) ([]string, string, error) {
+	var module []string
+	for strings.HasPrefix(s, "module.") {
+		parts := strings.SplitN(s, ".", 3)
+		if len(parts) != 3 || !identRe.MatchString(parts[1]) {
+			return nil, "", fmt.Errorf("address: %q has an invalid module path", s)
+		}
+		module = append(module, parts[1])
+		s = parts[2]
+	}
+	return module, s, nil
+}
+
+// ValidTag returns true if tag can be used in a tag:<name> selector
+func ValidTag(tag string) bool {
+	return identRe.MatchString(tag)
+}
+
+// Validate checks that every part of the address is well formed
+func (a Address) Validate() error {
+	if !identRe.MatchString(a.Type) {
+		return fmt.Errorf("invalid state type %q", a.Type)
+	}
+	if !identRe.MatchString(a.Command) {
+		return fmt.Errorf("invalid command %q", a.Command)
+	}
+	if a.Name == "" {
+		return errors.New("empty name")
+	}
+	if strings.ContainsAny(a.Name, "*[]") {
+		return fmt.Errorf("invalid name %q", a.Name)
+	}
+	for _, m := range a.Module {
+		if !identRe.MatchString(m) {
+			return fmt.Errorf("invalid module %q", m)
+		}
+	}
+	return nil
+}
+
+// String returns the canonical form of the address, which can be
+// parsed back by Parse.
+func (a Address) String() string {
+	var b strings.Builder
+	for _, m := range a.Module {
+		b.WriteString("module." + m + ".")
+	}
+	b.WriteString(a.Type + "." + a.Command + "." + a.Name)
+	if a.Index != NoIndex {
+		b.WriteString("[" + strconv.Itoa(a.Index) + "]")
+	}
+	return b.String()
+}
+
+// Selector matches one or more states, either by address pattern or
+// by tag. A pattern is an address whose parts may be shell style
+// globs, and which may end early in a *, e.g. apt.* or shell.run.*.
+type Selector struct {
+	// Tag is set for tag:<name> selectors
+	Tag     string
+	module  []string
+	pattern [3]string
+	index   int
+}
+
+// ParseSelector parses a selector. Plain addresses are valid
+// selectors that match a single state.
+func ParseSelector(s string) (*Selector, error) {
+	if s == "" {
+		return nil, ErrEmpty
+	}
+	if strings.HasPrefix(s, "tag:") {
+		tag := strings.TrimPrefix(s, "tag:")
+		if !ValidTag(tag) {
+			return nil, fmt.Errorf("address: %q has an invalid tag", s)
+		}
+		return &Selector{Tag: tag}, nil
+	}
+
+	module, rest, err := parseModule(s)
+	if err != nil {
+		return nil, err
+	}
+	sel := &Selector{module: module, index: NoIndex}
+
+	parts := strings.SplitN(rest, ".", 3)
+	if len(parts) < 3 && parts[len(parts)-1] == "*" {
+		for len(parts) < 3 {
+			parts = append(parts, "*")
+		}
+	}
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("address: %q must be of the form type.command.name", s)
+	}
+	if m := indexRe.FindStringSubmatch(parts[2]); m != nil {
+		parts[2] = m[1]
+		sel.index, _ = strconv.Atoi(m[2])
+	}
+	for i, p := range parts {
+		if _, err := path.Match(p, ""); err != nil || p == "" {
+			return nil, fmt.Errorf("address: %q has an invalid pattern %q", s, p)
+		}
+		sel.pattern[i] = p
+	}
+	return sel, nil
+}
+
+// IsWildcard returns true if the selector may match more than one state
+func (s *Selector) IsWildcard() bool {
+	if s.Tag != "" {
+		return true
+	}
+	for _, p := range s.pattern {
+		if strings.ContainsAny(p, "*?[") {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns true if the selector matches a state with the given
+// address and tags.
+func (s *Selector) Match(a Address, tags []string) bool {
+	if s.Tag != "" {
+		for _, t := range tags {
+			if t == s.Tag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(s.module) != len(a.Module) {
+		return false
+	}
+	for i, m := range s.module {
+		if m != a.Module[i] {
+			return false
+		}
+	}
+	if s.index != NoIndex && s.index != a.Index {
+		return false
+	}
+	for i, v := range []string{a.Type, a.Command, a.Name} {
+		if !match(s.pattern[i], v) {
+			return false
+		}
+	}
+	return true
+}
+
+// slash stands for / in match, since names such as file paths may
+// contain it and path.Match never lets * or ? match it.
+var slash = strings.NewReplacer("/", "\x00")
+
+// match reports whether name matches the shell pattern, where * and ?
+// also match /.
+func match(pattern, name string) bool {
+	ok, _ := path.Match(slash.Replace(pattern), slash.Replace(name))
+	return ok
+}
+
+// String returns the selector as it was written
+func (s *Selector) String() string {
+	if s.Tag != "" {
+		return "tag:" + s.Tag
+	}
+	a := Address{
+		Module:  s.module,
+		Type:    s.pattern[0],
+		Command: s.pattern[1],
+		Name:    s.pattern[2],
+		Index:   s.index,
+	}
+	return a.String()
+}
@@ -0,0 +1,86 @@
+package address
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out Address
+		err bool
+	}{
+		{"apt.install.base_system", New("apt", "install", "base_system"), false},
+		{"apt.install.foo.bar", New("apt", "install", "foo.bar"), false},
+		{"shell.run.web[2]", Address{Type: "shell", Command: "run", Name: "web", Index: 2}, false},
+		{"module.web.apt.install.nginx", Address{Module: []string{"web"}, Type: "apt", Command: "install", Name: "nginx", Index: NoIndex}, false},
+		{"apt.install", Address{}, true},
+		{"apt.*.base", Address{}, true},
+		{"1apt.install.x", Address{}, true},
+		{"", Address{}, true},
+	}
+
+	for _, test := range tests {
+		a, err := Parse(test.in)
+		if test.err {
+			assert.Error(t, err, test.in)
+			continue
+		}
+		assert.Nil(t, err, test.in)
+		assert.Equal(t, test.out, a, test.in)
+		assert.Equal(t, test.in, a.String())
+	}
+}
+
+func TestAddressesDoNotCollide(t *testing.T) {
+	a := New("apt", "install", "base_system")
+	b := New("apti", "nstall", "base_system")
+	assert.NotEqual(t, a.String(), b.String())
+}
+
+func TestSelector(t *testing.T) {
+	apt := New("apt", "install", "base_system")
+	shell := New("shell", "run", "install_gcloud")
+	motd := New("shell", "run", "/etc/motd")
+
+	var tests = []struct {
+		sel      string
+		wildcard bool
+		apt      bool
+		shell    bool
+		motd     bool
+	}{
+		{"apt.install.base_system", false, true, false, false},
+		{"apt.*", true, true, false, false},
+		{"shell.run.*", true, false, true, true},
+		{"*.*.install_*", true, false, true, false},
+		{"*", true, true, true, true},
+		{"tag:baseline", true, true, false, false},
+		{"shell.run./etc/*", true, false, false, true},
+		{"shell.run.*motd", true, false, false, true},
+		{"shell.run./etc?motd", true, false, false, true},
+	}
+
+	for _, test := range tests {
+		s, err := ParseSelector(test.sel)
+		if !assert.Nil(t, err, test.sel) {
+			continue
+		}
+		assert.Equal(t, test.wildcard, s.IsWildcard(), test.sel)
+		assert.Equal(t, test.apt, s.Match(apt, []string{"baseline"}), test.sel)
+		assert.Equal(t, test.shell, s.Match(shell, nil), test.sel)
+		assert.Equal(t, test.motd, s.Match(motd, nil), test.sel)
+	}
+}
+
+func TestSelectorString(t *testing.T) {
+	s, err := ParseSelector("apt.*")
+	assert.Nil(t, err)
+	assert.Equal(t, "apt.*.*", s.String())
+
+	s, err = ParseSelector("tag:db")
+	assert.Nil(t, err)
+	assert.Equal(t, "tag:db", s.String())
+}
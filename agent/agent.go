@@ -0,0 +1,225 @@
+/*
+Package agent applies a plan continuously: every interval, with a
+random splay so that a fleet does not apply at once, as soon as the
+state files change, and whenever it is asked to reload. Between runs,
+it can check the plan for drift without applying it.
+*/
+package agent
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/Cidan/pepper/drift"
+	"github.com/Cidan/pepper/plan"
+	"github.com/Cidan/pepper/watch"
+	"github.com/rs/zerolog/log"
+)
+
+// Settle is how long the agent waits after a file changes for other
+// changes to follow, so that saving several files applies once.
+var Settle = time.Second
+
+// Triggers of a run
+const (
+	TriggerStart    = "start"
+	TriggerInterval = "interval"
+	TriggerChange   = "change"
+	TriggerReload   = "reload"
+)
+
+// ApplyFunc loads and applies the plan. The report is nil if the plan
+// could not be applied at all.
+type ApplyFunc func(ctx context.Context) (*plan.Report, error)
+
+// DriftFunc loads the plan and checks it for drift. The report is nil
+// if the plan could not be checked at all.
+type DriftFunc func(ctx context.Context) (*drift.Report, error)
+
+// Config configures an agent. Dirs are watched for changes, with
+// inotify or by polling them every Poll. Drift is called every
+// DriftInterval, unless it is zero.
+type Config struct {
+	Interval      time.Duration
+	Splay         time.Duration
+	Dirs          []string
+	Poll          time.Duration
+	Apply         ApplyFunc
+	DriftInterval time.Duration
+	Drift         DriftFunc
+}
+
+// Agent applies a plan continuously
+type Agent struct {
+	config Config
+	reload chan struct{}
+
+	mu     sync.Mutex
+	status Status
+}
+
+// New returns an agent with the given configuration
+func New(c Config) *Agent {
+	return &Agent{
+		config: c,
+		reload: make(chan struct{}, 1),
+		status: Status{State: StateIdle, Started: time.Now()},
+	}
+}
+
+// Reload has the agent watch its directories again and apply now
+func (a *Agent) Reload() {
+	select {
+	case a.reload <- struct{}{}:
+	default:
+	}
+}
+
+// Run applies the plan once, then every time it is triggered until
+// ctx is done. A run that is triggered while another is in progress
+// follows it, and so do drift checks.
+func (a *Agent) Run(ctx context.Context) error {
+	w := a.watch()
+	defer func() {
+		if w != nil {
+			w.Close()
+		}
+	}()
+	var driftTick <-chan time.Time
+	if a.config.DriftInterval > 0 && a.config.Drift != nil {
+		ticker := time.NewTicker(a.config.DriftInterval)
+		defer ticker.Stop()
+		driftTick = ticker.C
+	}
+
+	trigger := TriggerStart
+	for {
+		a.apply(ctx, trigger)
+		next := time.Now().Add(a.wait())
+		a.mu.Lock()
+		a.status.Next = next
+		a.mu.Unlock()
+		log.Info().Time("next", next).Msg("Waiting for the next run")
+
+		if trigger = a.next(ctx, next, &w, driftTick); trigger == "" {
+			return nil
+		}
+	}
+}
+
+// next waits until the next run is due or triggered, and returns its
+// trigger, or nothing once ctx is done. A reload replaces w. Drift is
+// checked whenever driftTick ticks in the meantime.
+func (a *Agent) next(ctx context.Context, next time.Time, w *watch.Watcher, driftTick <-chan time.Time) string {
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+	for {
+		var changes <-chan string
+		if *w != nil {
+			changes = (*w).Changes()
+		}
+		select {
+		case <-ctx.Done():
+			return ""
+		case <-timer.C:
+			return TriggerInterval
+		case <-driftTick:
+			a.checkDrift(ctx)
+		case path, ok := <-changes:
+			if !ok {
+				log.Warn().Msg("Stopped watching the state files, applying on the interval only")
+				*w = nil
+				continue
+			}
+			log.Info().Str("path", path).Msg("State files changed")
+			settle(changes)
+			return TriggerChange
+		case <-a.reload:
+			log.Info().Msg("Reloading")
+			if *w != nil {
+				(*w).Close()
+			}
+			*w = a.watch()
+			return TriggerReload
+		}
+	}
+}
+
+// apply runs the plan and records the run in the status
+func (a *Agent) apply(ctx context.Context, trigger string) {
+	log.Info().Str("trigger", trigger).Msg("Applying")
+	a.mu.Lock()
+	a.status.State = StateRunning
+	a.mu.Unlock()
+
+	started := time.Now()
+	report, err := a.config.Apply(ctx)
+	if err != nil {
+		log.Error().Err(err).Str("trigger", trigger).Msg("Run failed")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.status.State = StateIdle
+	a.status.Runs++
+	a.status.Last = newRun(trigger, started, report, err)
+}
+
+// checkDrift checks the plan for drift and records it in the status
+func (a *Agent) checkDrift(ctx context.Context) {
+	log.Info().Msg("Checking for drift")
+	a.mu.Lock()
+	a.status.State = StateCheckingDrift
+	a.mu.Unlock()
+
+	started := time.Now()
+	report, err := a.config.Drift(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Drift check failed")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.status.State = StateIdle
+	a.status.Drift = newDriftCheck(started, report, err)
+}
+
+// wait returns how long to wait for the next run, which is the
+// interval and a random part of the splay.
+func (a *Agent) wait() time.Duration {
+	wait := a.config.Interval
+	if a.config.Splay > 0 {
+		wait += time.Duration(rand.Int63n(int64(a.config.Splay)))
+	}
+	return wait
+}
+
+// watch returns a watcher of the directories, or nil if there are none
+// or they cannot be watched.
+func (a *Agent) watch() watch.Watcher {
+	if len(a.config.Dirs) == 0 {
+		return nil
+	}
+	w, err := watch.New(a.config.Dirs, a.config.Poll)
+	if err != nil {
+		log.Warn().Err(err).Msg("Unable to watch the state files, applying on the interval only")
+		return nil
+	}
+	return w
+}
+
+// settle drains changes until none came for Settle
+func settle(changes <-chan string) {
+	for {
+		select {
+		case _, ok := <-changes:
+			if !ok {
+				return
+			}
+		case <-time.After(Settle):
+			return
+		}
+	}
+}
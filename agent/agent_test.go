@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Cidan/pepper/drift"
+	"github.com/Cidan/pepper/plan"
+	"github.com/stretchr/testify/assert"
+)
+
+// runs returns an apply function that reports each run on a channel
+func runs() (ApplyFunc, chan struct{}) {
+	ch := make(chan struct{}, 16)
+	return func(ctx context.Context) (*plan.Report, error) {
+		ch <- struct{}{}
+		return &plan.Report{Started: time.Now()}, nil
+	}, ch
+}
+
+// waitRun waits for a run, failing after a while
+func waitRun(t *testing.T, ch chan struct{}) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no run")
+	}
+}
+
+func TestRunTriggers(t *testing.T) {
+	defer func(d time.Duration) { Settle = d }(Settle)
+	Settle = 10 * time.Millisecond
+	dir, err := ioutil.TempDir("", "agent")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	apply, ch := runs()
+	a := New(Config{Interval: time.Hour, Dirs: []string{dir}, Poll: 10 * time.Millisecond, Apply: apply})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- a.Run(ctx) }()
+
+	waitRun(t, ch)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "web.hcl"), nil, 0644))
+	waitRun(t, ch)
+	a.Reload()
+	waitRun(t, ch)
+
+	cancel()
+	assert.Nil(t, <-done)
+	s := a.Status()
+	assert.Equal(t, 3, s.Runs)
+	assert.Equal(t, TriggerReload, s.Last.Trigger)
+	assert.Equal(t, StateIdle, s.State)
+}
+
+func TestRunInterval(t *testing.T) {
+	apply, ch := runs()
+	a := New(Config{Interval: 10 * time.Millisecond, Splay: 10 * time.Millisecond, Apply: apply})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.Run(ctx)
+
+	for i := 0; i < 3; i++ {
+		waitRun(t, ch)
+	}
+}
+
+func TestRunDrift(t *testing.T) {
+	apply, runs := runs()
+	checks := make(chan struct{}, 16)
+	a := New(Config{
+		Interval:      time.Hour,
+		Apply:         apply,
+		DriftInterval: 10 * time.Millisecond,
+		Drift: func(ctx context.Context) (*drift.Report, error) {
+			checks <- struct{}{}
+			return drift.New([]*plan.Change{
+				{Address: "test.run.a"},
+				{Address: "test.run.b", Changed: true},
+			}, time.Now()), nil
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- a.Run(ctx) }()
+
+	waitRun(t, runs)
+	waitRun(t, checks)
+	waitRun(t, checks)
+	cancel()
+	assert.Nil(t, <-done)
+
+	s := a.Status()
+	assert.Equal(t, 1, s.Runs)
+	if assert.NotNil(t, s.Drift) {
+		assert.Equal(t, 2, s.Drift.States)
+		assert.Equal(t, []string{"test.run.b"}, s.Drift.Drifted)
+	}
+}
+
+func TestHealthy(t *testing.T) {
+	a := New(Config{Interval: time.Minute})
+	now := a.status.Started
+	assert.Nil(t, a.Healthy(now))
+	assert.EqualError(t, a.Healthy(now.Add(3*time.Minute)), "no run finished since the agent started 3m0s ago")
+
+	a.status.Last = newRun(TriggerStart, now, nil, errors.New("invalid state file"))
+	assert.EqualError(t, a.Healthy(now), "the last run failed: invalid state file")
+
+	a.status.Last = newRun(TriggerStart, now, &plan.Report{}, errors.New("1 state failed"))
+	assert.Nil(t, a.Healthy(a.status.Last.Finished))
+	assert.Error(t, a.Healthy(a.status.Last.Finished.Add(3*time.Minute)))
+}
+
+func TestHandler(t *testing.T) {
+	a := New(Config{Interval: time.Minute})
+	a.status.Runs = 1
+	a.status.Last = newRun(TriggerInterval, time.Now(), nil, errors.New("invalid state file"))
+	srv := httptest.NewServer(a.Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/health")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	resp, err = http.Get(srv.URL + "/status")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	var s Status
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&s))
+	assert.Equal(t, 1, s.Runs)
+	assert.Equal(t, "invalid state file", s.Last.Error)
+}
@@ -0,0 +1,133 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Cidan/pepper/drift"
+	"github.com/Cidan/pepper/output"
+	"github.com/Cidan/pepper/plan"
+)
+
+// States of the agent
+const (
+	StateIdle          = "idle"
+	StateRunning       = "running"
+	StateCheckingDrift = "checking_drift"
+)
+
+// Status is what the agent is doing and how its last run and drift
+// check went
+type Status struct {
+	State   string      `json:"state"`
+	Started time.Time   `json:"started"`
+	Runs    int         `json:"runs"`
+	Next    time.Time   `json:"next_run,omitempty"`
+	Last    *Run        `json:"last_run,omitempty"`
+	Drift   *DriftCheck `json:"last_drift_check,omitempty"`
+}
+
+// Run is the outcome of a single run. Summary is missing if the plan
+// could not be applied at all, e.g. because a state file is invalid.
+type Run struct {
+	Trigger  string          `json:"trigger"`
+	Started  time.Time       `json:"started"`
+	Finished time.Time       `json:"finished"`
+	Error    string          `json:"error,omitempty"`
+	Summary  *output.Summary `json:"summary,omitempty"`
+}
+
+func newRun(trigger string, started time.Time, report *plan.Report, err error) *Run {
+	r := &Run{Trigger: trigger, Started: started, Finished: time.Now()}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if report != nil {
+		r.Summary = output.Summarize(report)
+	}
+	return r
+}
+
+// DriftCheck is the outcome of a drift check. The counts are missing
+// if the plan could not be checked at all.
+type DriftCheck struct {
+	Started    time.Time `json:"started"`
+	Finished   time.Time `json:"finished"`
+	Error      string    `json:"error,omitempty"`
+	States     int       `json:"states"`
+	Drifted    []string  `json:"drifted,omitempty"`
+	Remediated []string  `json:"remediated,omitempty"`
+	Errored    []string  `json:"errored,omitempty"`
+}
+
+func newDriftCheck(started time.Time, report *drift.Report, err error) *DriftCheck {
+	c := &DriftCheck{Started: started, Finished: time.Now()}
+	if err != nil {
+		c.Error = err.Error()
+	}
+	if report == nil {
+		return c
+	}
+	c.States = len(report.States)
+	for _, s := range report.States {
+		if s.Drifted {
+			c.Drifted = append(c.Drifted, s.Address)
+		}
+		if s.Remediated {
+			c.Remediated = append(c.Remediated, s.Address)
+		}
+		if s.Error != "" {
+			c.Errored = append(c.Errored, s.Address)
+		}
+	}
+	return c
+}
+
+// Status returns a copy of the status of the agent
+func (a *Agent) Status() Status {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.status
+}
+
+// Healthy returns an error if the last run could not apply the plan,
+// or if no run finished for twice the longest wait between runs,
+// which means the agent is stuck. States failing is not unhealthy, it
+// is shown in the status.
+func (a *Agent) Healthy(now time.Time) error {
+	s := a.Status()
+	limit := 2 * (a.config.Interval + a.config.Splay)
+	switch {
+	case s.Last == nil && now.Sub(s.Started) > limit:
+		return fmt.Errorf("no run finished since the agent started %s ago", now.Sub(s.Started).Round(time.Second))
+	case s.Last == nil:
+		return nil
+	case s.Last.Summary == nil:
+		return fmt.Errorf("the last run failed: %s", s.Last.Error)
+	case s.State == StateIdle && now.Sub(s.Last.Finished) > limit:
+		return fmt.Errorf("the last run finished %s ago", now.Sub(s.Last.Finished).Round(time.Second))
+	}
+	return nil
+}
+
+// Handler serves the health of the agent on /health, which answers
+// 503 when it is unhealthy, and its status as JSON on /status.
+func (a *Agent) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		if err := a.Healthy(time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(a.Status())
+	})
+	return mux
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Cidan/pepper/agent"
+	"github.com/Cidan/pepper/drift"
+	"github.com/Cidan/pepper/plan"
+	"github.com/rs/zerolog/log"
+)
+
+// agentCmd applies the state files continuously: every interval, when
+// they change and on SIGHUP. With -drift-interval, it also checks them
+// for drift in between. Health and status are served over HTTP.
+func agentCmd(args []string) error {
+	flags := flag.NewFlagSet("agent", flag.ContinueOnError)
+	l := newLoader(flags)
+	r := newRunner(flags)
+	d := newDrifter(flags)
+	interval := flags.Duration("interval", 30*time.Minute, "how often to apply")
+	splay := flags.Duration("splay", 5*time.Minute, "most random delay added to the interval, so that hosts do not all apply at once")
+	poll := flags.Duration("poll", 10*time.Second, "how often to look for changed state files when inotify is not available")
+	driftInterval := flags.Duration("drift-interval", 0,
+		"how often to check the state files for drift without applying them, 0 to not check")
+	listen := flags.String("listen", "127.0.0.1:9467", "address to serve /health and /status on, empty to not serve them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	a := agent.New(agent.Config{
+		Interval: *interval,
+		Splay:    *splay,
+		Dirs:     []string{l.dir, l.plugins.dir},
+		Poll:     *poll,
+		Apply: func(ctx context.Context) (*plan.Report, error) {
+			p, err := l.load()
+			if err != nil {
+				return nil, err
+			}
+			return r.execute(ctx, p, p.Hash())
+		},
+		DriftInterval: *driftInterval,
+		Drift: func(ctx context.Context) (*drift.Report, error) {
+			return d.check(ctx, l, r)
+		},
+	})
+
+	if *listen != "" {
+		ln, err := net.Listen("tcp", *listen)
+		if err != nil {
+			return err
+		}
+		srv := &http.Server{Handler: a.Handler()}
+		defer srv.Close()
+		go srv.Serve(ln)
+		log.Info().Str("address", ln.Addr().String()).Msg("Serving health and status")
+	}
+
+	// The run in progress stops on SIGINT or SIGTERM by itself
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	go func() {
+		for {
+			select {
+			case s := <-sig:
+				if s == syscall.SIGHUP {
+					a.Reload()
+					continue
+				}
+				log.Warn().Str("signal", s.String()).Msg("Stopping the agent")
+				cancel()
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return a.Run(ctx)
+}
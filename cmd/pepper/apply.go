@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Cidan/pepper/action"
+	"github.com/Cidan/pepper/facts"
+	"github.com/Cidan/pepper/journal"
+	"github.com/Cidan/pepper/lock"
+	"github.com/Cidan/pepper/output"
+	"github.com/Cidan/pepper/plan"
+	"github.com/Cidan/pepper/script"
+	"github.com/rs/zerolog/log"
+)
+
+// runner holds the flags controlling how apply executes a plan
+type runner struct {
+	rec        *recorder
+	checkpoint string
+	resume     bool
+	reboot     bool
+	// resumeArgs are the arguments that resume the run at boot
+	resumeArgs []string
+	grace      time.Duration
+	lock       string
+	lockWait   time.Duration
+	output     string
+	idempotent bool
+	root       string
+	// stdout is where the output is written
+	stdout io.Writer
+}
+
+// apply reads every state file, generates the plan and executes it.
+// Given a plan file saved by pepper plan -out, it executes exactly
+// that plan instead.
+func apply(args []string) error {
+	flags := flag.NewFlagSet("apply", flag.ContinueOnError)
+	l := newLoader(flags)
+	r := newRunner(flags)
+	// Only apply records its progress, so that the runs of the agent
+	// and drift remediation never replace the checkpoint of a run
+	// waiting for a reboot to resume.
+	flags.StringVar(&r.checkpoint, "checkpoint", filepath.Join(journal.DefaultDir, "checkpoint.json"),
+		"file to record progress in, empty to not record it")
+	flags.BoolVar(&r.resume, "resume", false, "skip states completed by the last run, if it did not finish")
+	flags.BoolVar(&r.reboot, "reboot", false,
+		"reboot when a state asks to, after installing a pepper-resume systemd unit that runs apply -resume at boot")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	r.resumeArgs = append([]string{"apply", "-resume"}, args...)
+
+	if flags.NArg() > 0 {
+		if l.selected() {
+			return errors.New("states cannot be selected when applying a saved plan")
+		}
+		if _, err := l.plugins.load(); err != nil {
+			return err
+		}
+		return applySaved(flags.Arg(0), r)
+	}
+
+	p, err := l.load()
+	if err != nil {
+		return err
+	}
+	return r.run(p, p.Hash())
+}
+
+// newRunner registers the flags controlling how a plan is executed
+func newRunner(flags *flag.FlagSet) *runner {
+	r := &runner{rec: newRecorder(flags), stdout: os.Stdout}
+	flags.DurationVar(&r.grace, "grace", action.DefaultGrace,
+		"how long commands are given to exit when the run is interrupted, before they are killed")
+	flags.StringVar(&r.lock, "lock", filepath.Join(journal.DefaultDir, "pepper.lock"),
+		"lock file that keeps runs from overlapping, empty to not lock")
+	flags.DurationVar(&r.lockWait, "lock-wait", time.Minute, "how long to wait for another run to finish")
+	flags.StringVar(&r.output, "output", "text", "output format: "+strings.Join(output.Formats, ", "))
+	rootFlag(flags, &r.root)
+	flags.BoolVar(&r.idempotent, "check-idempotence", false,
+		"check every applied state again after the run, failing those that would still change")
+	return r
+}
+
+// applySaved executes a saved plan, refusing to if the state files or
+// facts it was saved with have changed since.
+func applySaved(path string, r *runner) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// Script state types live with the state files the plan was
+	// saved from, and must be known before the plan is loaded.
+	var header plan.File
+	if err := json.Unmarshal(data, &header); err != nil {
+		return fmt.Errorf("invalid plan file: %s", err)
+	}
+	if _, err := script.Load(header.Dir); err != nil {
+		return err
+	}
+
+	p, file, err := plan.Load(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	current := plan.New()
+	if err := current.ReadDir(file.Dir); err != nil {
+		return err
+	}
+	fc, err := facts.GatherFrom(r.root)
+	if err != nil {
+		return err
+	}
+	if err := file.Verify(current.Hash(), fc); err != nil {
+		return err
+	}
+
+	return r.run(p, file.ConfigHash)
+}
+
+// run executes the plan with checkpoints, records it in the journal
+// and reboots if a state asked to. Before rebooting, a systemd unit is
+// installed to run apply -resume at boot, which removes it as soon as
+// it starts. With -check-idempotence, the applied states are checked
+// again before the run is recorded.
+// SIGINT or SIGTERM stops the run after the running state, which is
+// given the grace period to exit. Only one run may hold the lock at a
+// time.
+func (r *runner) run(p *plan.Plan, configHash string) error {
+	_, err := r.execute(context.Background(), p, configHash)
+	return err
+}
+
+// execute runs the plan like run, and also returns its report, which
+// is nil if the plan could not be executed at all. The run stops when
+// ctx is done, as it does on SIGINT or SIGTERM.
+func (r *runner) execute(ctx context.Context, p *plan.Plan, configHash string) (*plan.Report, error) {
+	out, err := output.New(r.output, r.stdout)
+	if err != nil {
+		return nil, err
+	}
+	if r.lock != "" {
+		lk, err := lock.Acquire(r.lock, r.lockWait)
+		if err != nil {
+			return nil, err
+		}
+		defer lk.Release()
+	}
+	if r.resume {
+		// Started at boot or not, the run is resumed once, so that a
+		// run that fails or reboots without asking to is not resumed
+		// again at every boot.
+		removeResume()
+	}
+
+	if r.checkpoint != "" {
+		c := plan.NewCheckpoint(r.checkpoint, configHash)
+		if r.resume {
+			var err error
+			if c, err = plan.ResumeCheckpoint(r.checkpoint, configHash); err != nil {
+				return nil, err
+			}
+		}
+		p.SetCheckpoint(c)
+	} else if r.resume {
+		return nil, errors.New("resuming needs a checkpoint file")
+	}
+
+	ctx, stop, err := systemContext(ctx, r.root, r.grace)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+	writeResults(p, out)
+	report, err := p.Execute(ctx)
+	if report == nil {
+		return nil, err
+	}
+	if r.idempotent && !report.Cancelled && report.Reboot == "" {
+		err = p.CheckIdempotence(ctx, report)
+	}
+	r.rec.record(report, configHash)
+	if err := out.Finish(report); err != nil {
+		log.Warn().Err(err).Msg("Unable to write output")
+	}
+	if report.Cancelled {
+		return report, errors.New("run cancelled")
+	}
+	if err != nil || report.Reboot == "" {
+		return report, err
+	}
+
+	if !r.reboot {
+		log.Warn().Str("state", report.Reboot).Msg("Reboot the host, then run pepper apply -resume")
+		return report, nil
+	}
+	if err := installResume(r.resumeArgs); err != nil {
+		log.Warn().Str("state", report.Reboot).Msg("Not rebooting, reboot the host, then run pepper apply -resume")
+		return report, fmt.Errorf("unable to resume the run at boot: %s", err)
+	}
+	log.Warn().Str("state", report.Reboot).Msg("Rebooting, the run resumes at boot")
+	return report, exec.Command("shutdown", "-r", "now").Run()
+}
+
+// writeResults writes the result of every state to out as it finishes
+func writeResults(p *plan.Plan, out output.Writer) {
+	p.Subscribe(plan.SubscriberFunc(func(e plan.Event) {
+		if f, ok := e.(*plan.StateFinished); ok {
+			if err := out.Result(f.Result); err != nil {
+				log.Warn().Err(err).Msg("Unable to write output")
+			}
+		}
+	}))
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	pdocs "github.com/Cidan/pepper/docs"
+	"github.com/Cidan/pepper/states"
+)
+
+// docs writes the state reference documentation to stdout
+func docs(args []string) error {
+	flags := flag.NewFlagSet("docs", flag.ContinueOnError)
+	format := flags.String("format", "markdown", "output format: markdown, man or json-schema")
+	examples := flags.String("examples", "", "directory of example state files, instead of the built-in ones")
+	plugins := newPluginFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if _, err := plugins.load(); err != nil {
+		return err
+	}
+
+	ex := states.Examples()
+	if *examples != "" {
+		ex = os.DirFS(*examples)
+	}
+	ref, err := pdocs.New(ex)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "markdown", "md":
+		return ref.Markdown(os.Stdout)
+	case "man":
+		return ref.Man(os.Stdout)
+	case "json-schema", "jsonschema":
+		return ref.JSONSchema(os.Stdout)
+	}
+	return fmt.Errorf("unknown docs format %q", *format)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Cidan/pepper/drift"
+	"github.com/Cidan/pepper/plan"
+	"github.com/rs/zerolog/log"
+)
+
+// drifter holds the flags controlling where drift is reported and
+// which drifted states are remediated.
+type drifter struct {
+	out       string
+	textfile  string
+	remediate []string
+	// stdout and stderr are where the report and the summary are
+	// written
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// newDrifter registers the drift report and remediation flags
+func newDrifter(flags *flag.FlagSet) *drifter {
+	d := &drifter{stdout: os.Stdout, stderr: os.Stderr}
+	flags.StringVar(&d.out, "out", "", "write the drift report as JSON to this file, - for stdout")
+	flags.StringVar(&d.textfile, "textfile", "",
+		"write the drift report as a Prometheus textfile, e.g. /var/lib/node_exporter/pepper.prom")
+	flags.Var((*listFlag)(&d.remediate), "remediate",
+		"apply the drifted states with these tags, or without !tag, to bring them back in line")
+	return d
+}
+
+// driftCmd checks every state without applying it and reports those
+// that drifted from the state files. It fails if any drifted state
+// was not remediated, or could not be checked. States that cannot tell
+// whether they drifted, such as shell commands, are reported as
+// unknown. When the JSON report goes to stdout, everything else goes
+// to stderr.
+func driftCmd(args []string) error {
+	flags := flag.NewFlagSet("drift", flag.ContinueOnError)
+	l := newLoader(flags)
+	r := newRunner(flags)
+	d := newDrifter(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	return d.run(context.Background(), l, r)
+}
+
+// run checks the plan for drift and writes a summary of the states
+// that did not match, or could not tell.
+func (d *drifter) run(ctx context.Context, l *loader, r *runner) error {
+	w := d.stdout
+	if d.out == "-" {
+		w = d.stderr
+		r.stdout = d.stderr
+	}
+	report, err := d.check(ctx, l, r)
+	if report == nil {
+		return err
+	}
+	for _, s := range report.States {
+		switch {
+		case s.Error != "":
+			fmt.Fprintf(w, "! %s: %s\n", s.Address, s.Error)
+		case s.Remediated:
+			fmt.Fprintf(w, "+ %s: %s\n", s.Address, s.Comment)
+		case s.Drifted:
+			fmt.Fprintf(w, "~ %s: %s\n", s.Address, s.Comment)
+		case s.Unknown:
+			fmt.Fprintf(w, "? %s: %s\n", s.Address, s.Comment)
+		}
+	}
+	c := report.Counts()
+	fmt.Fprintf(w, "\n%d drifted, %d remediated, %d errored, %d unknown, %d states checked\n",
+		c.Drifted, c.Remediated, c.Errored, c.Unknown, c.Checked)
+	if err != nil {
+		return err
+	}
+	return report.Err()
+}
+
+// check loads the plan, checks it for drift, remediates the drifted
+// states matching -remediate and writes the report. The report is nil
+// if the plan could not be checked at all. Checking and remediating
+// stop when parent is done.
+func (d *drifter) check(parent context.Context, l *loader, r *runner) (*drift.Report, error) {
+	p, err := l.load()
+	if err != nil {
+		return nil, err
+	}
+	ctx, stop, err := systemContext(parent, r.root, r.grace)
+	if err != nil {
+		return nil, err
+	}
+	report, err := drift.Detect(ctx, p)
+	stop()
+	if err != nil {
+		return nil, err
+	}
+
+	var addresses []string
+	if len(d.remediate) > 0 {
+		addresses = report.Remediable(d.remediate)
+	}
+	if len(addresses) > 0 {
+		log.Info().Strs("states", addresses).Msg("Remediating drift")
+		err = d.apply(parent, p, addresses, r, report)
+	}
+	if werr := d.write(report); werr != nil {
+		log.Warn().Err(werr).Msg("Unable to write the drift report")
+	}
+	return report, err
+}
+
+// apply executes the drifted states at addresses, along with what
+// they require, and records which were remediated in the report.
+func (d *drifter) apply(ctx context.Context, p *plan.Plan, addresses []string, r *runner, report *drift.Report) error {
+	sub, err := p.Select(plan.Selection{Targets: addresses})
+	if err != nil {
+		return err
+	}
+	res, err := r.execute(ctx, sub, p.Hash())
+	if res != nil {
+		report.Remediated(res)
+	}
+	return err
+}
+
+// write writes the report to the JSON file and the textfile
+func (d *drifter) write(report *drift.Report) error {
+	switch d.out {
+	case "":
+	case "-":
+		if err := report.WriteJSON(d.stdout); err != nil {
+			return err
+		}
+	default:
+		f, err := os.Create(d.out)
+		if err != nil {
+			return err
+		}
+		if err := report.WriteJSON(f); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	if d.textfile != "" {
+		return report.WriteTextfile(d.textfile)
+	}
+	return nil
+}
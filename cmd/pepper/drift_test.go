@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Cidan/pepper/drift"
+	"github.com/stretchr/testify/assert"
+)
+
+const driftStates = `
+marker touch web {
+  path = "/web"
+  tags = "web"
+}
+
+marker touch db {
+  path = "/db"
+  tags = "db"
+}
+
+shell run restart {
+  cmd = "true"
+}
+`
+
+// driftScript is a state type that drifts until its file exists
+const driftScript = `
+commands = {"touch": {"attributes": {"path": {"type": "string", "required": True}}}}
+
+def check(command, attrs):
+    if file_exists(attrs["path"]):
+        return None
+    return {"changed": True, "comment": "would create " + attrs["path"]}
+
+def apply(command, attrs):
+    if check(command, attrs) == None:
+        return None
+    write_file(attrs["path"], "")
+    return {"changed": True, "comment": "created " + attrs["path"]}
+`
+
+// TestDriftJSON checks that the JSON report is all that is written to
+// stdout with -out -, even when drifted states are remediated, and
+// that shell states are reported as unknown rather than drifted.
+func TestDriftJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drift")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	states := filepath.Join(dir, "states")
+	root := filepath.Join(dir, "root")
+	assert.Nil(t, os.Mkdir(states, 0755))
+	assert.Nil(t, os.Mkdir(root, 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(states, "web.hcl"), []byte(driftStates), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(states, "marker.star"), []byte(driftScript), 0644))
+
+	flags := flag.NewFlagSet("drift", flag.ContinueOnError)
+	l := newLoader(flags)
+	r := newRunner(flags)
+	d := newDrifter(flags)
+	var stdout, stderr bytes.Buffer
+	d.stdout, d.stderr = &stdout, &stderr
+	assert.Nil(t, flags.Parse([]string{
+		"-dir", states,
+		"-plugins", filepath.Join(dir, "plugins"),
+		"-journal", filepath.Join(dir, "journal"),
+		"-lock", filepath.Join(dir, "pepper.lock"),
+		"-root", root,
+		"-remediate", "web",
+		"-out", "-",
+	}))
+	err = d.run(context.Background(), l, r)
+	assert.EqualError(t, err, "1 state drifted")
+
+	assert.Contains(t, stderr.String(), "+ marker.touch.web: would create /web\n")
+	assert.Contains(t, stderr.String(), "~ marker.touch.db: would create /db\n")
+	assert.Contains(t, stderr.String(), "? shell.run.restart: would run true\n")
+	assert.Contains(t, stderr.String(), "\n2 drifted, 1 remediated, 0 errored, 1 unknown, 3 states checked\n")
+	_, err = os.Stat(filepath.Join(root, "web"))
+	assert.Nil(t, err)
+
+	var report struct {
+		drift.Report
+		drift.Counts
+	}
+	if assert.Nil(t, json.Unmarshal(stdout.Bytes(), &report), stdout.String()) {
+		assert.Equal(t, drift.Counts{Checked: 3, Drifted: 2, Remediated: 1, Unknown: 1}, report.Counts)
+		assert.Equal(t, "marker.touch.web", report.States[0].Address)
+		assert.True(t, report.States[0].Remediated)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/Cidan/pepper/plan"
+)
+
+// export writes the plan as a shell script that applies it without
+// pepper.
+func export(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	l := newLoader(flags)
+	format := flags.String("format", "sh", "export format: "+strings.Join(plan.ExportFormats, ", "))
+	out := flags.String("out", "", "write to this file instead of standard output")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	p, err := l.load()
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		return p.Export(os.Stdout, *format)
+	}
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if err := p.Export(f, *format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
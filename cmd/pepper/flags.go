@@ -0,0 +1,20 @@
+package main
+
+import "strings"
+
+// listFlag is a flag that may be repeated or given a comma separated
+// list, e.g. -target a -target b or -target a,b.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+// graphCmd prints the plan graph as a tree
+func graphCmd(args []string) error {
+	flags := flag.NewFlagSet("graph", flag.ContinueOnError)
+	l := newLoader(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	p, err := l.load()
+	if err != nil {
+		return err
+	}
+	out, err := p.Print()
+	if err != nil {
+		return err
+	}
+	fmt.Print(out)
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Cidan/pepper/journal"
+	"github.com/Cidan/pepper/plan"
+	"github.com/rs/zerolog/log"
+)
+
+// recorder holds the flags controlling how apply records runs in the
+// journal.
+type recorder struct {
+	dir  string
+	keep journal.Retention
+}
+
+// newRecorder registers the journal flags
+func newRecorder(flags *flag.FlagSet) *recorder {
+	r := &recorder{}
+	flags.StringVar(&r.dir, "journal", journal.DefaultDir, "directory of the run journal, empty to not record runs")
+	flags.IntVar(&r.keep.MaxRuns, "keep-runs", 1000, "most runs to keep in the journal, 0 for no limit")
+	flags.DurationVar(&r.keep.MaxAge, "keep-for", 0, "how long to keep runs in the journal, 0 for no limit")
+	return r
+}
+
+// record appends the report of a run to the journal and prunes it.
+// A journal that cannot be written does not fail the run.
+func (r *recorder) record(report *plan.Report, configHash string) {
+	if r.dir == "" || report == nil {
+		return
+	}
+	j, err := journal.Open(r.dir)
+	if err == nil {
+		run := journal.NewRun(report, configHash)
+		if err = j.Append(run); err == nil {
+			log.Info().Str("run", run.ID).Msg("Run recorded")
+			_, err = j.Prune(r.keep, time.Now())
+		}
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("journal", r.dir).Msg("Unable to record run")
+	}
+}
+
+// history lists past runs, or shows a single run in detail
+func history(args []string) error {
+	if len(args) > 0 && args[0] == "show" {
+		return historyShow(args[1:])
+	}
+
+	flags := flag.NewFlagSet("history", flag.ContinueOnError)
+	dir := flags.String("journal", journal.DefaultDir, "directory of the run journal")
+	n := flags.Int("n", 20, "number of runs to list, 0 for all")
+	since := flags.String("since", "", "only list runs started on or after this date (YYYY-MM-DD)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	j, err := journal.Open(*dir)
+	if err != nil {
+		return err
+	}
+	runs, err := j.Runs()
+	if err != nil {
+		return err
+	}
+
+	if *since != "" {
+		t, err := time.ParseInLocation("2006-01-02", *since, time.Local)
+		if err != nil {
+			return err
+		}
+		for len(runs) > 0 && runs[0].Started.Before(t) {
+			runs = runs[1:]
+		}
+	}
+	if *n > 0 && len(runs) > *n {
+		runs = runs[len(runs)-*n:]
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTARTED\tDURATION\tOK\tCHANGED\tFAILED\tSKIPPED\tCONFIG")
+	for _, r := range runs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%.12s\n",
+			r.ID, r.Started.Local().Format("2006-01-02 15:04:05"), r.Duration.Round(time.Millisecond),
+			r.Count(plan.StatusOK), r.Count(plan.StatusChanged),
+			r.Count(plan.StatusFailed), r.Count(plan.StatusSkipped), r.ConfigHash)
+	}
+	return w.Flush()
+}
+
+// historyShow prints every state of a single run
+func historyShow(args []string) error {
+	flags := flag.NewFlagSet("history show", flag.ContinueOnError)
+	dir := flags.String("journal", journal.DefaultDir, "directory of the run journal")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: pepper history show <id>")
+	}
+
+	j, err := journal.Open(*dir)
+	if err != nil {
+		return err
+	}
+	r, err := j.Run(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Run %s\nStarted:  %s\nDuration: %s\nConfig:   %s\n\n",
+		r.ID, r.Started.Local().Format(time.RFC1123), r.Duration.Round(time.Millisecond), r.ConfigHash)
+	if r.Cancelled {
+		fmt.Printf("The run was cancelled before every state ran.\n\n")
+	}
+	for _, s := range r.States {
+		took := s.Duration.Round(time.Millisecond).String()
+		if s.Attempts > 1 {
+			took += fmt.Sprintf(", %d attempts", s.Attempts)
+		}
+		fmt.Printf("%-8s %s (%s)\n", s.Status, s.Address, took)
+		if s.Comment != "" {
+			fmt.Printf("         %s\n", s.Comment)
+		}
+		if s.Error != "" {
+			fmt.Printf("         error: %s\n", s.Error)
+		}
+		if s.Output != "" {
+			fmt.Printf("%s\n", indent(s.Output, "         | "))
+		}
+	}
+	return nil
+}
+
+// indent prefixes every line of s
+func indent(s, prefix string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	return prefix + strings.Join(lines, "\n"+prefix)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"time"
+
+	"github.com/Cidan/pepper/plan"
+	"github.com/Cidan/pepper/plugin"
+	"github.com/Cidan/pepper/script"
+	"github.com/Cidan/pepper/states"
+)
+
+// loader holds the flags shared by every command that reads state
+// files into a plan.
+type loader struct {
+	dir     string
+	sel     plan.Selection
+	plugins *pluginFlags
+	defined []*states.Definition
+}
+
+// pluginFlags hold where plugin state types are found
+type pluginFlags struct {
+	dir     string
+	timeout time.Duration
+}
+
+// newPluginFlags registers the plugin flags
+func newPluginFlags(flags *flag.FlagSet) *pluginFlags {
+	f := &pluginFlags{}
+	flags.StringVar(&f.dir, "plugins", "/usr/lib/pepper/plugins", "directory of plugin state types")
+	flags.DurationVar(&f.timeout, "plugin-timeout", plugin.DefaultTimeout, "how long a plugin may take to answer")
+	return f
+}
+
+// load registers every plugin as a state type
+func (f *pluginFlags) load() ([]*states.Definition, error) {
+	return plugin.Load(f.dir, f.timeout)
+}
+
+// newLoader registers the state file and selection flags
+func newLoader(flags *flag.FlagSet) *loader {
+	l := &loader{plugins: newPluginFlags(flags)}
+	flags.StringVar(&l.dir, "dir", "./examples", "directory of state files")
+	flags.Var((*listFlag)(&l.sel.Targets), "target", "only use these states and what they require")
+	flags.Var((*listFlag)(&l.sel.Exclude), "exclude", "never use these states")
+	flags.Var((*listFlag)(&l.sel.Tags), "tags", "only use states with these tags, or without !tag")
+	flags.BoolVar(&l.sel.Dependents, "dependents", false, "also use states that depend on the targets")
+	return l
+}
+
+// selected returns true if any selection flag was given
+func (l *loader) selected() bool {
+	sel := l.sel
+	return len(sel.Targets) > 0 || len(sel.Exclude) > 0 || len(sel.Tags) > 0 || sel.Dependents
+}
+
+// load reads every state file, generates the plan and applies the
+// selection to it. Plugins and the scripts kept with the state files
+// are registered first, replacing those registered by an earlier
+// call, so that a long running agent picks up their changes.
+func (l *loader) load() (*plan.Plan, error) {
+	for _, d := range l.defined {
+		states.Remove(d.Name)
+	}
+	l.defined = nil
+	defs, err := l.plugins.load()
+	l.defined = append(l.defined, defs...)
+	if err != nil {
+		return nil, err
+	}
+	defs, err = script.Load(l.dir)
+	l.defined = append(l.defined, defs...)
+	if err != nil {
+		return nil, err
+	}
+
+	p := plan.New()
+	if err := p.ReadDir(l.dir); err != nil {
+		return nil, err
+	}
+	if err := p.Generate(); err != nil {
+		return nil, err
+	}
+	return p.Select(l.sel)
+}
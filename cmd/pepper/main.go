@@ -1,21 +1,45 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"strings"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
-
-	"github.com/Cidan/pepper/plan"
 )
 
+// command is a pepper subcommand, called with the remaining arguments
+type command func(args []string) error
+
+var commands = map[string]command{
+	"agent":   agentCmd,
+	"apply":   apply,
+	"docs":    docs,
+	"drift":   driftCmd,
+	"export":  export,
+	"graph":   graphCmd,
+	"history": history,
+	"plan":    planCmd,
+	"verify":  verify,
+}
+
 func main() {
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
-	p := plan.New()
-	p.ReadDir("./examples")
-	err := p.Generate()
-	p.Execute()
-	if err != nil {
-		panic(err)
+
+	// Without a subcommand pepper applies, as it always has
+	name, args := "apply", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "pepper: unknown command %q\n", name)
+		os.Exit(2)
+	}
+	if err := cmd(args); err != nil {
+		log.Error().Err(err).Str("command", name).Msg("Command failed")
+		os.Exit(1)
 	}
 }
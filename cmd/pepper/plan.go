@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Cidan/pepper/action"
+	"github.com/Cidan/pepper/facts"
+)
+
+// planCmd prints what apply would change, without changing anything,
+// and optionally saves the plan for pepper apply to execute later.
+func planCmd(args []string) error {
+	flags := flag.NewFlagSet("plan", flag.ContinueOnError)
+	l := newLoader(flags)
+	out := flags.String("out", "", "save the plan to this file")
+	var root string
+	rootFlag(flags, &root)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	p, err := l.load()
+	if err != nil {
+		return err
+	}
+	ctx, stop, err := systemContext(context.Background(), root, action.DefaultGrace)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	changes, err := p.Check(ctx)
+	if err != nil {
+		return err
+	}
+
+	changed := 0
+	for _, c := range changes {
+		mark := " "
+		if c.Changed {
+			mark = "~"
+			changed++
+		}
+		fmt.Printf("%s %s: %s\n", mark, c.Address, c.Comment)
+	}
+	fmt.Printf("\n%d to change, %d unchanged\n", changed, len(changes)-changed)
+
+	if *out == "" {
+		return nil
+	}
+	fc, err := facts.GatherFrom(root)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := p.Save(f, l.dir, changes, fc); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Plan saved to %s, run pepper apply %s to apply it\n", *out, *out)
+	return nil
+}
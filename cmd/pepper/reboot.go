@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// resumeUnit is the systemd unit that resumes a run at boot
+var resumeUnit = "/etc/systemd/system/pepper-resume.service"
+
+// systemdQuote quotes s as a single word of a systemd command line,
+// where $ and % would otherwise be expanded.
+var systemdQuote = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", "$$", "%", "%%")
+
+// resumeService returns the unit running pepper with args in dir at
+// boot
+func resumeService(exe, dir string, args []string) string {
+	words := make([]string, len(args)+1)
+	for i, w := range append([]string{exe}, args...) {
+		words[i] = `"` + systemdQuote.Replace(w) + `"`
+	}
+	return fmt.Sprintf(`# Installed by pepper apply -reboot, removed as the run resumes
+[Unit]
+Description=Resume the pepper run interrupted by a reboot
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=oneshot
+WorkingDirectory=%s
+ExecStart=%s
+
+[Install]
+WantedBy=multi-user.target
+`, strings.Replace(dir, "%", "%%", -1), strings.Join(words, " "))
+}
+
+// installResume installs and enables a systemd unit that runs pepper
+// with args at boot, from the current directory so that relative
+// paths still hold.
+func installResume(args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(resumeUnit, []byte(resumeService(exe, dir, args)), 0644); err != nil {
+		return err
+	}
+	if out, err := exec.Command("systemctl", "enable", "pepper-resume.service").CombinedOutput(); err != nil {
+		os.Remove(resumeUnit)
+		return fmt.Errorf("systemctl enable: %s: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// removeResume disables and removes the unit installed by
+// installResume, if any. A resumed run calls it before running
+// anything, and installs the unit again if it reboots once more.
+func removeResume() {
+	if _, err := os.Stat(resumeUnit); err != nil {
+		return
+	}
+	if out, err := exec.Command("systemctl", "disable", "pepper-resume.service").CombinedOutput(); err != nil {
+		log.Warn().Err(err).Str("output", strings.TrimSpace(string(out))).Msg("Unable to disable the resume unit")
+	}
+	if err := os.Remove(resumeUnit); err != nil {
+		log.Warn().Err(err).Msg("Unable to remove the resume unit")
+	}
+}
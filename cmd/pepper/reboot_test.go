@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Cidan/pepper/plan"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResumeService(t *testing.T) {
+	unit := resumeService("/usr/bin/pepper", "/srv/states 100%", []string{"apply", "-resume", "-dir", `it's "$HOME"`})
+	assert.Contains(t, unit, "WorkingDirectory=/srv/states 100%%\n")
+	assert.Contains(t, unit, `ExecStart="/usr/bin/pepper" "apply" "-resume" "-dir" "it's \"$$HOME\""`+"\n")
+	assert.Contains(t, unit, "WantedBy=multi-user.target\n")
+}
+
+// TestResumeRemovesUnit checks that a resumed run removes the unit
+// before running, so that a failed run is not resumed at every boot.
+func TestResumeRemovesUnit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resume")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer func(unit string) { resumeUnit = unit }(resumeUnit)
+	resumeUnit = filepath.Join(dir, "pepper-resume.service")
+	assert.Nil(t, ioutil.WriteFile(resumeUnit, []byte(resumeService("/usr/bin/pepper", dir, nil)), 0644))
+
+	flags := flag.NewFlagSet("apply", flag.ContinueOnError)
+	r := newRunner(flags)
+	assert.Nil(t, flags.Parse([]string{
+		"-journal", filepath.Join(dir, "journal"),
+		"-lock", filepath.Join(dir, "pepper.lock"),
+	}))
+	r.checkpoint = filepath.Join(dir, "checkpoint.json")
+	r.resume = true
+	r.stdout = ioutil.Discard
+
+	p := plan.New()
+	assert.Nil(t, p.Add("shell.run.fails", plan.Attrs{"cmd": "false"}))
+	assert.Nil(t, p.Generate())
+	_, err = r.execute(context.Background(), p, p.Hash())
+	assert.Error(t, err)
+	_, err = os.Stat(resumeUnit)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Cidan/pepper/action"
+)
+
+// rootFlag registers the flag choosing the root filesystem to manage
+func rootFlag(flags *flag.FlagSet, root *string) {
+	flags.StringVar(root, "root", "/",
+		"root filesystem to manage, such as an image mounted at /mnt/image, with commands chrooted into it")
+}
+
+// systemContext returns a context for running states against the
+// system at root, which is cancelled with parent or on SIGINT or
+// SIGTERM. Commands are chrooted into root unless it is /, and are
+// given the grace period to exit once cancelled.
+func systemContext(parent context.Context, root string, grace time.Duration) (context.Context, func(), error) {
+	if !filepath.IsAbs(root) {
+		return nil, nil, fmt.Errorf("root %q must be an absolute path", root)
+	}
+	fi, err := os.Stat(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !fi.IsDir() {
+		return nil, nil, fmt.Errorf("root %s is not a directory", root)
+	}
+
+	ctx, stop := signalContext(parent)
+	ctx = action.WithRoot(ctx, root)
+	ctx = action.WithRunner(ctx, &action.Shell{Grace: grace, Root: root})
+	return ctx, stop, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/Cidan/pepper/action"
+	"github.com/Cidan/pepper/output"
+	"github.com/rs/zerolog/log"
+)
+
+// verify runs the assertions of the state files without applying
+// anything else, and fails if any of them does not hold.
+func verify(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	l := newLoader(flags)
+	format := flags.String("output", "text", "output format: "+strings.Join(output.Formats, ", "))
+	var root string
+	rootFlag(flags, &root)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	out, err := output.New(*format, os.Stdout)
+	if err != nil {
+		return err
+	}
+	p, err := l.load()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop, err := systemContext(context.Background(), root, action.DefaultGrace)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	writeResults(p, out)
+	report, err := p.Verify(ctx)
+	if report == nil {
+		return err
+	}
+	if err := out.Finish(report); err != nil {
+		log.Warn().Err(err).Msg("Unable to write output")
+	}
+	return err
+}
@@ -0,0 +1,6 @@
+/*
+Package docs generates reference documentation for every registered
+state type from its schema, as Markdown, a man page or a JSON Schema
+usable by editors to validate .hcl.json files.
+*/
+package docs
@@ -0,0 +1,77 @@
+package docs
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Cidan/pepper/states"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkdown(t *testing.T) {
+	r, err := New(states.Examples())
+	assert.Nil(t, err)
+
+	var b bytes.Buffer
+	assert.Nil(t, r.Markdown(&b))
+	assert.Contains(t, b.String(), "### apt install")
+	assert.Contains(t, b.String(), "| `packages` | list(string) | yes |  |")
+	assert.Contains(t, b.String(), "| `allow_no_version` | bool | no | `false` |")
+	assert.Contains(t, b.String(), "```hcl\napt install base_system {")
+}
+
+func TestExamples(t *testing.T) {
+	r, err := New(states.Examples())
+	assert.Nil(t, err)
+	var b bytes.Buffer
+	assert.Nil(t, r.Markdown(&b))
+
+	files, err := filepath.Glob("../states/testdata/*.hcl")
+	assert.Nil(t, err)
+	examples := map[string]bool{}
+	for _, f := range files {
+		examples[strings.TrimSuffix(filepath.Base(f), ".hcl")] = true
+	}
+	for _, d := range r.Types {
+		for _, c := range d.Commands {
+			if !examples[d.Name+"_"+c.Command] {
+				continue
+			}
+			example := r.Example(d, c)
+			assert.Contains(t, example, d.Name+" "+c.Command+" ", "%s %s", d.Name, c.Command)
+			assert.Contains(t, b.String(), "```hcl\n"+example, "%s %s", d.Name, c.Command)
+		}
+	}
+	assert.Contains(t, r.Examples, "assert.file_exists")
+	assert.Contains(t, r.Examples, "assert.port_listening")
+}
+
+func TestMan(t *testing.T) {
+	r, err := New(states.Examples())
+	assert.Nil(t, err)
+
+	var b bytes.Buffer
+	assert.Nil(t, r.Man(&b))
+	assert.Contains(t, b.String(), ".SS shell run\n")
+	assert.Contains(t, b.String(), ".B cmd\n(string, required)")
+}
+
+func TestJSONSchema(t *testing.T) {
+	r, err := New(nil)
+	assert.Nil(t, err)
+
+	var b bytes.Buffer
+	assert.Nil(t, r.JSONSchema(&b))
+
+	var doc map[string]interface{}
+	assert.Nil(t, json.Unmarshal(b.Bytes(), &doc))
+	apt := doc["properties"].(map[string]interface{})["apt"].(map[string]interface{})
+	install := apt["properties"].(map[string]interface{})["install"].(map[string]interface{})
+	state := install["additionalProperties"].(map[string]interface{})
+	assert.Equal(t, []interface{}{"packages"}, state["required"])
+	order := state["properties"].(map[string]interface{})["order"].(map[string]interface{})
+	assert.Equal(t, []interface{}{"string", "integer"}, order["type"])
+}
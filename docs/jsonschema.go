@@ -0,0 +1,118 @@
+package docs
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/Cidan/pepper/schema"
+)
+
+// JSONSchema writes a JSON Schema (draft-07) describing state files
+// written in HCL's JSON syntax, i.e. {"type": {"command": {"name": {}}}}.
+func (r *Reference) JSONSchema(w io.Writer) error {
+	types := map[string]interface{}{}
+	for _, d := range r.Types {
+		commands := map[string]interface{}{}
+		for _, c := range d.Commands {
+			commands[c.Command] = map[string]interface{}{
+				"type":                 "object",
+				"description":          c.Description,
+				"additionalProperties": r.jsonState(c),
+			}
+		}
+		types[d.Name] = map[string]interface{}{
+			"type":                 "object",
+			"description":          d.Description,
+			"properties":           commands,
+			"additionalProperties": false,
+		}
+	}
+
+	doc := map[string]interface{}{
+		"$schema":              "http://json-schema.org/draft-07/schema#",
+		"title":                "pepper state file",
+		"type":                 "object",
+		"properties":           types,
+		"additionalProperties": false,
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// jsonState returns the schema of a single named state
+func (r *Reference) jsonState(c *schema.State) map[string]interface{} {
+	props := map[string]interface{}{}
+	required := []string{}
+	for k, s := range r.Meta {
+		t := jsonType(s)
+		if s.Type == schema.TypeList {
+			// Reserved list attributes also accept a single value
+			t = map[string]interface{}{
+				"anyOf": []interface{}{t, jsonType(elemOf(s))},
+			}
+		}
+		if k == "order" {
+			// A number, or first or last
+			t["type"] = []string{"string", "integer"}
+		}
+		t["description"] = s.Description
+		props[k] = t
+	}
+	for _, k := range c.Attributes() {
+		s := c.Schema[k]
+		t := jsonType(s)
+		t["description"] = s.Description
+		if s.Default != nil {
+			t["default"] = s.Default
+		}
+		props[k] = t
+		if s.Required {
+			required = append(required, k)
+		}
+	}
+
+	out := map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		out["required"] = required
+	}
+	return out
+}
+
+func elemOf(s *schema.Schema) *schema.Schema {
+	if elem, ok := s.Elem.(*schema.Schema); ok {
+		return elem
+	}
+	return s
+}
+
+func jsonType(s *schema.Schema) map[string]interface{} {
+	switch s.Type {
+	case schema.TypeBool:
+		return map[string]interface{}{"type": "boolean"}
+	case schema.TypeInt:
+		return map[string]interface{}{"type": "integer"}
+	case schema.TypeFloat:
+		return map[string]interface{}{"type": "number"}
+	case schema.TypeString:
+		return map[string]interface{}{"type": "string"}
+	case schema.TypeList:
+		t := map[string]interface{}{"type": "array"}
+		if elem, ok := s.Elem.(*schema.Schema); ok {
+			t["items"] = jsonType(elem)
+		}
+		return t
+	case schema.TypeMap:
+		t := map[string]interface{}{"type": "object"}
+		if elem, ok := s.Elem.(*schema.Schema); ok {
+			t["additionalProperties"] = jsonType(elem)
+		}
+		return t
+	}
+	return map[string]interface{}{}
+}
@@ -0,0 +1,66 @@
+package docs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Cidan/pepper/schema"
+)
+
+// Man writes the reference as a pepper-states(5) man page in roff
+func (r *Reference) Man(w io.Writer) error {
+	b := bufio.NewWriter(w)
+
+	fmt.Fprintf(b, ".TH PEPPER-STATES 5 \"\" \"pepper\" \"Pepper State Reference\"\n")
+	fmt.Fprintf(b, ".SH NAME\npepper-states \\- state types understood by pepper\n")
+	fmt.Fprintf(b, ".SH DESCRIPTION\nEvery state is declared as\n.I type command name\nfollowed by a block of attributes.\n")
+
+	fmt.Fprintf(b, ".SH COMMON ATTRIBUTES\n")
+	manAttributes(b, r.Meta, r.MetaAttributes())
+
+	fmt.Fprintf(b, ".SH STATES\n")
+	for _, d := range r.Types {
+		for _, c := range d.Commands {
+			fmt.Fprintf(b, ".SS %s %s\n", d.Name, c.Command)
+			if c.Description != "" {
+				fmt.Fprintf(b, "%s\n", roff(c.Description))
+			} else if d.Description != "" {
+				fmt.Fprintf(b, "%s\n", roff(d.Description))
+			}
+			manAttributes(b, c.Schema, c.Attributes())
+			if ex := r.Example(d, c); ex != "" {
+				fmt.Fprintf(b, ".PP\n.B Example\n.PP\n.nf\n%s.fi\n", roff(ex))
+			}
+		}
+	}
+
+	return b.Flush()
+}
+
+func manAttributes(b *bufio.Writer, attrs map[string]*schema.Schema, keys []string) {
+	for _, k := range keys {
+		s := attrs[k]
+		flags := []string{typeName(s)}
+		if s.Required {
+			flags = append(flags, "required")
+		}
+		if def := defaultValue(s); def != "" {
+			flags = append(flags, "default "+def)
+		}
+		fmt.Fprintf(b, ".TP\n.B %s\n(%s) %s\n", k, roff(strings.Join(flags, ", ")), roff(s.Description))
+	}
+}
+
+// roff escapes text so it is not interpreted as roff requests
+func roff(s string) string {
+	s = strings.Replace(s, "\\", "\\e", -1)
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if strings.HasPrefix(l, ".") || strings.HasPrefix(l, "'") {
+			lines[i] = "\\&" + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
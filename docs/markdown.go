@@ -0,0 +1,64 @@
+package docs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Cidan/pepper/schema"
+)
+
+// Markdown writes the reference as a single Markdown document
+func (r *Reference) Markdown(w io.Writer) error {
+	b := bufio.NewWriter(w)
+
+	fmt.Fprintf(b, "# State reference\n\n")
+	fmt.Fprintf(b, "Every state is declared as `type command name { ... }`.\n\n")
+
+	fmt.Fprintf(b, "## Common attributes\n\n")
+	fmt.Fprintf(b, "These attributes are accepted by every state.\n\n")
+	markdownTable(b, r.Meta, r.MetaAttributes())
+
+	for _, d := range r.Types {
+		fmt.Fprintf(b, "## %s\n\n", d.Name)
+		if d.Description != "" {
+			fmt.Fprintf(b, "%s\n\n", d.Description)
+		}
+		for _, c := range d.Commands {
+			fmt.Fprintf(b, "### %s %s\n\n", d.Name, c.Command)
+			if c.Description != "" {
+				fmt.Fprintf(b, "%s\n\n", c.Description)
+			}
+			markdownTable(b, c.Schema, c.Attributes())
+			if ex := r.Example(d, c); ex != "" {
+				fmt.Fprintf(b, "#### Example\n\n```hcl\n%s```\n\n", ex)
+			}
+		}
+	}
+
+	return b.Flush()
+}
+
+func markdownTable(b *bufio.Writer, attrs map[string]*schema.Schema, keys []string) {
+	if len(keys) == 0 {
+		fmt.Fprintf(b, "This command takes no attributes.\n\n")
+		return
+	}
+	fmt.Fprintf(b, "| Attribute | Type | Required | Default | Description |\n")
+	fmt.Fprintf(b, "|-----------|------|----------|---------|-------------|\n")
+	for _, k := range keys {
+		s := attrs[k]
+		required := "no"
+		if s.Required {
+			required = "yes"
+		}
+		def := defaultValue(s)
+		if def != "" {
+			def = "`" + def + "`"
+		}
+		fmt.Fprintf(b, "| `%s` | %s | %s | %s | %s |\n",
+			k, typeName(s), required, def, strings.Replace(s.Description, "|", "\\|", -1))
+	}
+	fmt.Fprintf(b, "\n")
+}
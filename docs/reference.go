@@ -0,0 +1,103 @@
+package docs
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/Cidan/pepper/plan"
+	"github.com/Cidan/pepper/schema"
+	"github.com/Cidan/pepper/states"
+)
+
+// Reference is the data rendered into every documentation format
+type Reference struct {
+	Types    []*states.Definition
+	Meta     map[string]*schema.Schema
+	Examples map[string]string
+}
+
+// New builds a reference for every registered state type. Examples
+// are read from the top of examples, such as states.Examples(), where
+// a file named type_command.hcl or type_command_anything.hcl is an
+// example for "type command". Since commands may contain underscores,
+// the longest registered type_command a file name starts with wins.
+// Nil examples means none.
+func New(examples fs.FS) (*Reference, error) {
+	r := &Reference{
+		Types:    states.Definitions(),
+		Meta:     plan.Meta,
+		Examples: map[string]string{},
+	}
+	if examples == nil {
+		return r, nil
+	}
+
+	files, err := fs.Glob(examples, "*.hcl")
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		key := r.exampleKey(strings.TrimSuffix(file, ".hcl"))
+		if key == "" {
+			continue
+		}
+		data, err := fs.ReadFile(examples, file)
+		if err != nil {
+			return nil, err
+		}
+		r.Examples[key] += strings.TrimSpace(string(data)) + "\n"
+	}
+	return r, nil
+}
+
+// exampleKey returns the type.command that an example file is named
+// after, or nothing if it names no registered command.
+func (r *Reference) exampleKey(name string) string {
+	key, longest := "", 0
+	for _, d := range r.Types {
+		for _, c := range d.Commands {
+			prefix := d.Name + "_" + c.Command
+			if len(prefix) > longest && (name == prefix || strings.HasPrefix(name, prefix+"_")) {
+				key, longest = d.Name+"."+c.Command, len(prefix)
+			}
+		}
+	}
+	return key
+}
+
+// Example returns the example for a command of a state type, if any
+func (r *Reference) Example(d *states.Definition, c *schema.State) string {
+	return r.Examples[d.Name+"."+c.Command]
+}
+
+// MetaAttributes returns the names of the reserved attributes, sorted
+func (r *Reference) MetaAttributes() []string {
+	keys := make([]string, 0, len(r.Meta))
+	for k := range r.Meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// typeName returns the documented type of an attribute, including
+// the element type of lists and maps, e.g. list(string).
+func typeName(s *schema.Schema) string {
+	if elem, ok := s.Elem.(*schema.Schema); ok {
+		return fmt.Sprintf("%s(%s)", s.Type, typeName(elem))
+	}
+	return s.Type.String()
+}
+
+// defaultValue returns the documented default of an attribute
+func defaultValue(s *schema.Schema) string {
+	if s.Default == nil {
+		return ""
+	}
+	if str, ok := s.Default.(string); ok {
+		return fmt.Sprintf("%q", str)
+	}
+	return fmt.Sprintf("%v", s.Default)
+}
@@ -0,0 +1,201 @@
+/*
+Package drift reports the states whose resources no longer match the
+state files, found by checking the plan without applying it, as JSON
+and as a Prometheus textfile.
+*/
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Cidan/pepper/plan"
+)
+
+// Report is the outcome of checking every state for drift
+type Report struct {
+	Time   time.Time `json:"time"`
+	States []*State  `json:"states"`
+}
+
+// State is whether a single state drifted. Error is set if it could
+// not be checked, and Unknown if it cannot tell whether it drifted,
+// such as a shell command that runs every time. Remediated is set once
+// an apply brought it back in line, and RemediationError if that apply
+// failed.
+type State struct {
+	Address          string   `json:"address"`
+	Drifted          bool     `json:"drifted"`
+	Unknown          bool     `json:"unknown,omitempty"`
+	Comment          string   `json:"comment,omitempty"`
+	Attributes       []string `json:"attributes,omitempty"`
+	Tags             []string `json:"tags,omitempty"`
+	Error            string   `json:"error,omitempty"`
+	Remediated       bool     `json:"remediated,omitempty"`
+	RemediationError string   `json:"remediation_error,omitempty"`
+}
+
+// Counts are the number of states checked, and of those that drifted,
+// were remediated, could not be checked or cannot tell.
+type Counts struct {
+	Checked    int `json:"checked"`
+	Drifted    int `json:"drifted"`
+	Remediated int `json:"remediated"`
+	Errored    int `json:"errored"`
+	Unknown    int `json:"unknown"`
+}
+
+// Detect checks every state of the plan without changing anything,
+// and reports those that would change as drifted. A state that cannot
+// be checked is reported with its error, and the others are still
+// checked. States that cannot tell whether they drifted are reported
+// as unknown rather than drifted.
+func Detect(ctx context.Context, p *plan.Plan) (*Report, error) {
+	changes, err := p.Check(ctx)
+	if err != nil && changes == nil {
+		return nil, err
+	}
+	return New(changes, time.Now()), nil
+}
+
+// New returns a report of the changes predicted at t
+func New(changes []*plan.Change, t time.Time) *Report {
+	r := &Report{Time: t, States: []*State{}}
+	for _, c := range changes {
+		r.States = append(r.States, &State{
+			Address:    c.Address,
+			Drifted:    c.Changed && !c.Unknown,
+			Unknown:    c.Unknown,
+			Comment:    c.Comment,
+			Attributes: c.Attributes,
+			Tags:       c.Tags,
+			Error:      c.Error,
+		})
+	}
+	return r
+}
+
+// Drifted returns the states that drifted
+func (r *Report) Drifted() []*State {
+	var drifted []*State
+	for _, s := range r.States {
+		if s.Drifted {
+			drifted = append(drifted, s)
+		}
+	}
+	return drifted
+}
+
+// Remediable returns the addresses of the drifted states matching the
+// tags, where a tag prefixed with ! excludes states with that tag, as
+// with plan.Selection.
+func (r *Report) Remediable(tags []string) []string {
+	var addresses []string
+	for _, s := range r.Drifted() {
+		if matchTags(s.Tags, tags) {
+			addresses = append(addresses, s.Address)
+		}
+	}
+	return addresses
+}
+
+// matchTags returns true if the state tags have one of the wanted
+// tags, or no wanted tags are given, and none of the excluded ones.
+func matchTags(have, tags []string) bool {
+	has := map[string]bool{}
+	for _, t := range have {
+		has[t] = true
+	}
+	wanted, matched := false, false
+	for _, t := range tags {
+		if strings.HasPrefix(t, "!") {
+			if has[strings.TrimPrefix(t, "!")] {
+				return false
+			}
+			continue
+		}
+		wanted = true
+		matched = matched || has[t]
+	}
+	return matched || !wanted
+}
+
+// Remediated records the outcome of applying the drifted states
+func (r *Report) Remediated(report *plan.Report) {
+	results := map[string]*plan.Result{}
+	for _, res := range report.Results {
+		results[res.Address] = res
+	}
+	for _, s := range r.Drifted() {
+		res, ok := results[s.Address]
+		if !ok {
+			continue
+		}
+		switch res.Status {
+		case plan.StatusOK, plan.StatusChanged:
+			s.Remediated = true
+		case plan.StatusFailed:
+			s.RemediationError = res.Error
+		}
+	}
+}
+
+// Counts returns the number of states in the report by outcome
+func (r *Report) Counts() Counts {
+	c := Counts{Checked: len(r.States)}
+	for _, s := range r.States {
+		if s.Drifted {
+			c.Drifted++
+		}
+		if s.Remediated {
+			c.Remediated++
+		}
+		if s.Error != "" {
+			c.Errored++
+		}
+		if s.Unknown {
+			c.Unknown++
+		}
+	}
+	return c
+}
+
+// Err returns an error if any state drifted and was not remediated,
+// or could not be checked.
+func (r *Report) Err() error {
+	c := r.Counts()
+	var problems []string
+	if n := c.Drifted - c.Remediated; n > 0 {
+		problems = append(problems, states(n)+" drifted")
+	}
+	if c.Errored > 0 {
+		problems = append(problems, states(c.Errored)+" could not be checked")
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, ", "))
+}
+
+// states returns n states, in words
+func states(n int) string {
+	if n == 1 {
+		return "1 state"
+	}
+	return fmt.Sprintf("%d states", n)
+}
+
+// WriteJSON writes the report as indented JSON, with the counts
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		*Report
+		Counts
+	}{r, r.Counts()})
+}
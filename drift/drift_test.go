@@ -0,0 +1,107 @@
+package drift
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Cidan/pepper/plan"
+	"github.com/stretchr/testify/assert"
+)
+
+// testReport returns a report of five states, two of them drifted,
+// one that could not be checked and one that cannot tell
+func testReport() *Report {
+	return New([]*plan.Change{
+		{Address: "apt.install.base", Comment: "already installed", Tags: []string{"baseline"}},
+		{Address: "apt.install.web", Changed: true, Comment: "would install nginx",
+			Attributes: []string{"packages"}, Tags: []string{"web", "baseline"}},
+		{Address: `shell.run."quoted"`, Changed: true, Comment: "would run true", Tags: []string{"slow"}},
+		{Address: "apt.install.db", Error: "dpkg-query not found", Tags: []string{"db"}},
+		{Address: "shell.run.restart", Changed: true, Comment: "would run systemctl restart nginx",
+			Attributes: []string{"cmd"}, Tags: []string{"web"}, Unknown: true},
+	}, time.Unix(1500000000, 0).UTC())
+}
+
+func TestRemediable(t *testing.T) {
+	r := testReport()
+	var tests = []struct {
+		tags     []string
+		expected []string
+	}{
+		{nil, []string{"apt.install.web", `shell.run."quoted"`}},
+		{[]string{"baseline"}, []string{"apt.install.web"}},
+		{[]string{"!web"}, []string{`shell.run."quoted"`}},
+		{[]string{"baseline", "!web"}, nil},
+		{[]string{"db"}, nil},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, r.Remediable(test.tags), "%v", test.tags)
+	}
+}
+
+func TestRemediated(t *testing.T) {
+	r := testReport()
+	assert.EqualError(t, r.Err(), "2 states drifted, 1 state could not be checked")
+
+	r.Remediated(&plan.Report{Results: []*plan.Result{
+		{Address: "apt.install.base", Status: plan.StatusOK},
+		{Address: "apt.install.web", Status: plan.StatusChanged},
+	}})
+	assert.True(t, r.States[1].Remediated)
+	assert.False(t, r.States[0].Remediated)
+	assert.EqualError(t, r.Err(), "1 state drifted, 1 state could not be checked")
+
+	r.Remediated(&plan.Report{Results: []*plan.Result{
+		{Address: `shell.run."quoted"`, Status: plan.StatusFailed, Error: "exit status 1"},
+	}})
+	assert.Equal(t, "exit status 1", r.States[2].RemediationError)
+	assert.Equal(t, Counts{Checked: 5, Drifted: 2, Remediated: 1, Errored: 1, Unknown: 1}, r.Counts())
+	assert.False(t, r.States[4].Drifted)
+
+	r = New([]*plan.Change{{Address: "apt.install.base"}}, time.Now())
+	assert.Nil(t, r.Err())
+}
+
+func TestWrite(t *testing.T) {
+	r := testReport()
+	r.Remediated(&plan.Report{Results: []*plan.Result{
+		{Address: "apt.install.web", Status: plan.StatusChanged},
+	}})
+
+	var tests = []struct {
+		golden string
+		write  func(b *bytes.Buffer) error
+	}{
+		{"drift.json", func(b *bytes.Buffer) error { return r.WriteJSON(b) }},
+		{"drift.prom", func(b *bytes.Buffer) error { return r.WritePrometheus(b) }},
+	}
+	for _, test := range tests {
+		var b bytes.Buffer
+		assert.Nil(t, test.write(&b), test.golden)
+		expected, err := ioutil.ReadFile(filepath.Join("testdata", test.golden))
+		assert.Nil(t, err)
+		assert.Equal(t, string(expected), b.String(), test.golden)
+	}
+}
+
+func TestWriteTextfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drift")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "pepper.prom")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("stale"), 0644))
+	assert.Nil(t, testReport().WriteTextfile(path))
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "pepper_drift_drifted_states 2\n")
+
+	// Only the textfile is left behind
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, files, 1)
+}
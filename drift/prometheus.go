@@ -0,0 +1,63 @@
+package drift
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// labelEscaper escapes a Prometheus label value
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WritePrometheus writes the report in the Prometheus text format
+func (r *Report) WritePrometheus(w io.Writer) error {
+	c := r.Counts()
+	b := bufio.NewWriter(w)
+	gauge := func(name, help string, value interface{}) {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, value)
+	}
+	gauge("pepper_drift_states", "Number of states checked for drift.", c.Checked)
+	gauge("pepper_drift_drifted_states", "Number of states that drifted from the state files.", c.Drifted)
+	gauge("pepper_drift_remediated_states", "Number of drifted states brought back in line.", c.Remediated)
+	gauge("pepper_drift_errored_states", "Number of states that could not be checked for drift.", c.Errored)
+	gauge("pepper_drift_unknown_states", "Number of states that cannot tell whether they drifted.", c.Unknown)
+	gauge("pepper_drift_last_check_timestamp_seconds", "When the states were last checked for drift.", r.Time.Unix())
+
+	fmt.Fprint(b, "# HELP pepper_drift_state_drifted Whether the state drifted from the state files and was not remediated.\n")
+	fmt.Fprint(b, "# TYPE pepper_drift_state_drifted gauge\n")
+	for _, s := range r.States {
+		value := 0
+		if s.Drifted && !s.Remediated {
+			value = 1
+		}
+		fmt.Fprintf(b, "pepper_drift_state_drifted{state=\"%s\"} %d\n", labelEscaper.Replace(s.Address), value)
+	}
+	return b.Flush()
+}
+
+// WriteTextfile writes the report in the Prometheus text format to
+// path, for the node exporter's textfile collector. The file is
+// replaced at once, so that it is never collected half written.
+func (r *Report) WriteTextfile(path string) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), ".pepper-drift")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := r.WritePrometheus(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,84 @@
+/*
+Package facts gathers information about the host pepper runs on.
+*/
+package facts
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Facts are named values describing the host, e.g. os_id=debian
+type Facts map[string]string
+
+// Gather collects the facts of the running host. Facts that cannot
+// be read are left out rather than failing.
+func Gather() (Facts, error) {
+	return GatherFrom("/")
+}
+
+// GatherFrom collects the facts of the system installed at root, such
+// as an image being built. The hostname and release are read from the
+// files under root, while the kernel and architecture are the running
+// host's.
+func GatherFrom(root string) (Facts, error) {
+	f := Facts{
+		"os":   runtime.GOOS,
+		"arch": runtime.GOARCH,
+	}
+
+	if filepath.Clean(root) == "/" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		f["hostname"] = hostname
+	} else if hostname, err := ioutil.ReadFile(filepath.Join(root, "etc/hostname")); err == nil {
+		f["hostname"] = strings.TrimSpace(string(hostname))
+	}
+
+	if kernel, err := ioutil.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		f["kernel"] = strings.TrimSpace(string(kernel))
+	}
+
+	if release, err := os.Open(filepath.Join(root, "etc/os-release")); err == nil {
+		defer release.Close()
+		scanner := bufio.NewScanner(release)
+		for scanner.Scan() {
+			kv := strings.SplitN(scanner.Text(), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch kv[0] {
+			case "ID":
+				f["os_id"] = strings.Trim(kv[1], `"`)
+			case "VERSION_ID":
+				f["os_version"] = strings.Trim(kv[1], `"`)
+			}
+		}
+	}
+
+	return f, nil
+}
+
+// Hash returns a stable hash of every fact
+func (f Facts) Hash() string {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		h.Write([]byte(k + "=" + f[k] + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -1,8 +1,10 @@
 package graph
 
 import (
+	"container/heap"
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/Cidan/pepper/set"
@@ -38,6 +40,7 @@ type Digraph struct {
 	m           sync.RWMutex
 	adjList     map[Vertex]*AdjacencyList
 	uuidMap     map[string]Vertex
+	edgeKinds   map[Vertex]map[Vertex]*set.Set
 	edgeCount   int
 	root        Vertex
 	vertexCount int
@@ -46,8 +49,9 @@ type Digraph struct {
 // New creates a new acyclic Digraph, and initializes its adjacency list
 func New() *Digraph {
 	return &Digraph{
-		adjList: map[Vertex]*AdjacencyList{},
-		uuidMap: map[string]Vertex{},
+		adjList:   map[Vertex]*AdjacencyList{},
+		uuidMap:   map[string]Vertex{},
+		edgeKinds: map[Vertex]map[Vertex]*set.Set{},
 	}
 }
 
@@ -122,6 +126,138 @@ func (d *Digraph) AddEdge(source Vertex, target Vertex) error {
 	return nil
 }
 
+// AddEdgeKind adds an edge between two vertices, if it does not already
+// exist, and labels it with kind. A single edge may carry several kinds.
+func (d *Digraph) AddEdgeKind(source Vertex, target Vertex, kind string) error {
+	err := d.AddEdge(source, target)
+	if err != nil && err != ErrEdgeExists {
+		return err
+	}
+
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	kinds, ok := d.edgeKinds[source]
+	if !ok {
+		kinds = map[Vertex]*set.Set{}
+		d.edgeKinds[source] = kinds
+	}
+	if _, ok := kinds[target]; !ok {
+		kinds[target] = set.New()
+	}
+	kinds[target].Add(kind)
+
+	return nil
+}
+
+// EdgeKinds returns the kinds of the edge between source and target,
+// sorted. Edges added without a kind have none.
+func (d *Digraph) EdgeKinds(source Vertex, target Vertex) []string {
+	d.m.RLock()
+	defer d.m.RUnlock()
+
+	kinds, ok := d.edgeKinds[source][target]
+	if !ok {
+		return nil
+	}
+	out := make([]string, 0, kinds.Size())
+	for _, k := range kinds.Enumerate() {
+		out = append(out, k.(string))
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Children returns every vertex the given vertex has an edge to
+func (d *Digraph) Children(source Vertex) []Vertex {
+	d.m.RLock()
+	defer d.m.RUnlock()
+
+	adjList, ok := d.adjList[source]
+	if !ok {
+		return nil
+	}
+	return adjList.Adjacent()
+}
+
+// Parents returns every vertex with an edge to the given vertex
+func (d *Digraph) Parents(target Vertex) []Vertex {
+	d.m.RLock()
+	defer d.m.RUnlock()
+
+	var parents []Vertex
+	for v, adjList := range d.adjList {
+		if adjList.Search(target) != nil {
+			parents = append(parents, v)
+		}
+	}
+	return parents
+}
+
+// LessFn reports whether vertex a should sort before vertex b
+type LessFn func(a, b Vertex) bool
+
+// Sort returns every vertex in topological order, so that each vertex
+// comes after all of the vertices with an edge to it. Whenever several
+// vertices are ready at once, the least according to less comes first,
+// which makes the order stable for a given graph.
+func (d *Digraph) Sort(less LessFn) ([]Vertex, error) {
+	d.m.RLock()
+	defer d.m.RUnlock()
+
+	indegree := map[Vertex]int{}
+	for v, adjList := range d.adjList {
+		if _, ok := indegree[v]; !ok {
+			indegree[v] = 0
+		}
+		for _, t := range adjList.Adjacent() {
+			indegree[t]++
+		}
+	}
+
+	ready := &vertexHeap{less: less}
+	for v, n := range indegree {
+		if n == 0 {
+			heap.Push(ready, v)
+		}
+	}
+
+	var sorted []Vertex
+	for ready.Len() > 0 {
+		v := heap.Pop(ready).(Vertex)
+		sorted = append(sorted, v)
+		for _, t := range d.adjList[v].Adjacent() {
+			indegree[t]--
+			if indegree[t] == 0 {
+				heap.Push(ready, t)
+			}
+		}
+	}
+
+	if len(sorted) != len(d.adjList) {
+		return nil, ErrCycle
+	}
+	return sorted, nil
+}
+
+// vertexHeap is a heap of vertices ordered by less
+type vertexHeap struct {
+	vertices []Vertex
+	less     LessFn
+}
+
+func (h *vertexHeap) Len() int           { return len(h.vertices) }
+func (h *vertexHeap) Less(i, j int) bool { return h.less(h.vertices[i], h.vertices[j]) }
+func (h *vertexHeap) Swap(i, j int)      { h.vertices[i], h.vertices[j] = h.vertices[j], h.vertices[i] }
+func (h *vertexHeap) Push(x interface{}) { h.vertices = append(h.vertices, x) }
+
+func (h *vertexHeap) Pop() interface{} {
+	n := len(h.vertices)
+	v := h.vertices[n-1]
+	h.vertices = h.vertices[:n-1]
+	return v
+}
+
 func (d *Digraph) LinkToRoot(target Vertex) error {
 	if d.root == target {
 		return nil
@@ -160,6 +296,55 @@ func (d *Digraph) DepthFirstSearch(source Vertex, target Vertex) bool {
 	return result
 }
 
+// Descendants returns every vertex reachable from the given vertex
+func (d *Digraph) Descendants(source Vertex) []Vertex {
+	d.m.RLock()
+	defer d.m.RUnlock()
+
+	if _, ok := d.adjList[source]; !ok {
+		return nil
+	}
+	discovered := set.New()
+	d.dfs(discovered, source)
+	return toVertices(discovered)
+}
+
+// Ancestors returns every vertex with a path to the given vertex
+func (d *Digraph) Ancestors(target Vertex) []Vertex {
+	d.m.RLock()
+	defer d.m.RUnlock()
+
+	// Walk the reversed graph from the target
+	parents := map[Vertex][]Vertex{}
+	for v, adjList := range d.adjList {
+		for _, t := range adjList.Adjacent() {
+			parents[t] = append(parents[t], v)
+		}
+	}
+
+	discovered := set.New()
+	stack := []Vertex{target}
+	for len(stack) > 0 {
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, p := range parents[v] {
+			if discovered.Add(p) {
+				stack = append(stack, p)
+			}
+		}
+	}
+	return toVertices(discovered)
+}
+
+func toVertices(s *set.Set) []Vertex {
+	values := s.Enumerate()
+	vertices := make([]Vertex, len(values))
+	for i, v := range values {
+		vertices[i] = v
+	}
+	return vertices
+}
+
 // dfs implements a recursive Depth-First Search algorithm
 func (d *Digraph) dfs(discovered *set.Set, target Vertex) {
 	// Get the adjacency list for this vertex
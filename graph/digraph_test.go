@@ -0,0 +1,81 @@
+package graph
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testGraph returns the graph root -> a -> b -> d, root -> c -> d,
+// with e on its own.
+func testGraph(t *testing.T) *Digraph {
+	d := New()
+	for _, v := range []string{"root", "a", "b", "c", "d", "e"} {
+		assert.Nil(t, d.AddVertex(v, v))
+	}
+	for _, e := range [][2]string{{"root", "a"}, {"a", "b"}, {"b", "d"}, {"root", "c"}, {"c", "d"}} {
+		assert.Nil(t, d.AddEdge(e[0], e[1]))
+	}
+	return d
+}
+
+// names returns the vertices as sorted strings
+func names(vertices []Vertex) []string {
+	out := []string{}
+	for _, v := range vertices {
+		out = append(out, v.(string))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestAncestors(t *testing.T) {
+	d := testGraph(t)
+	var tests = []struct {
+		vertex   string
+		expected []string
+	}{
+		{"d", []string{"a", "b", "c", "root"}},
+		{"b", []string{"a", "root"}},
+		{"root", []string{}},
+		{"e", []string{}},
+		{"missing", []string{}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, names(d.Ancestors(test.vertex)), test.vertex)
+	}
+}
+
+func TestDescendants(t *testing.T) {
+	d := testGraph(t)
+	var tests = []struct {
+		vertex   string
+		expected []string
+	}{
+		{"root", []string{"a", "b", "c", "d"}},
+		{"a", []string{"b", "d"}},
+		{"d", []string{}},
+		{"missing", []string{}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, names(d.Descendants(test.vertex)), test.vertex)
+	}
+}
+
+func TestSort(t *testing.T) {
+	d := testGraph(t)
+	less := func(a, b Vertex) bool { return a.(string) < b.(string) }
+	sorted, err := d.Sort(less)
+	assert.Nil(t, err)
+	assert.Equal(t, []Vertex{"e", "root", "a", "b", "c", "d"}, sorted)
+
+	// Reversing the order only changes which ready vertex comes first
+	sorted, err = d.Sort(func(a, b Vertex) bool { return less(b, a) })
+	assert.Nil(t, err)
+	assert.Equal(t, []Vertex{"root", "e", "c", "a", "b", "d"}, sorted)
+
+	// A cycle cannot be added, so the graph always sorts
+	assert.Equal(t, ErrCycle, d.AddEdge("d", "a"))
+	assert.Equal(t, ErrCycle, d.AddEdge("d", "d"))
+}
@@ -0,0 +1,224 @@
+/*
+Package journal records every pepper run in an append-only JSON lines
+file, so past runs can be inspected with pepper history.
+*/
+package journal
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Cidan/pepper/plan"
+)
+
+// DefaultDir is where pepper keeps its state between runs
+const DefaultDir = "/var/lib/pepper"
+
+// ExcerptSize is the most output kept for each state
+const ExcerptSize = 2048
+
+const fileName = "journal.jsonl"
+
+var (
+	// ErrNotFound is returned when no run has the requested id
+	ErrNotFound = errors.New("journal: run not found")
+
+	// ErrAmbiguous is returned when an id prefix matches several runs
+	ErrAmbiguous = errors.New("journal: run id is ambiguous")
+)
+
+// Run is a single pepper run as recorded in the journal
+type Run struct {
+	ID         string         `json:"id"`
+	Started    time.Time      `json:"started"`
+	Duration   time.Duration  `json:"duration"`
+	ConfigHash string         `json:"config_hash"`
+	Cancelled  bool           `json:"cancelled,omitempty"`
+	States     []*plan.Result `json:"states"`
+}
+
+// NewRun records the report of a run against the config with the
+// given hash. Output is cut down to its last ExcerptSize bytes.
+func NewRun(report *plan.Report, configHash string) *Run {
+	r := &Run{
+		ID:         newID(report.Started),
+		Started:    report.Started,
+		Duration:   report.Duration,
+		ConfigHash: configHash,
+		Cancelled:  report.Cancelled,
+	}
+	for _, res := range report.Results {
+		res := *res
+		res.Output = Excerpt(res.Output, ExcerptSize)
+		r.States = append(r.States, &res)
+	}
+	return r
+}
+
+// Count returns the number of states that ended with the status
+func (r *Run) Count(status plan.Status) int {
+	report := &plan.Report{Results: r.States}
+	return report.Count(status)
+}
+
+// newID returns a sortable, unique run id, e.g. 20180205T080708-1a2b3c
+func newID(t time.Time) string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return t.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(b)
+}
+
+// Excerpt returns the last n bytes of s, marking that it was cut
+func Excerpt(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return "..." + s[len(s)-n:]
+}
+
+// Retention limits the runs kept in the journal. Zero values keep
+// everything.
+type Retention struct {
+	MaxRuns int
+	MaxAge  time.Duration
+}
+
+// Journal is the run journal in a directory
+type Journal struct {
+	path string
+}
+
+// Open opens the journal in dir, creating dir if needed
+func Open(dir string) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Journal{path: filepath.Join(dir, fileName)}, nil
+}
+
+// Append adds a run to the end of the journal
+func (j *Journal) Append(r *Run) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Runs returns every run in the journal, oldest first
+func (j *Journal) Runs() ([]*Run, error) {
+	f, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var runs []*Run
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r Run
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("journal: %s:%d: %s", j.path, line, err)
+		}
+		runs = append(runs, &r)
+	}
+	return runs, scanner.Err()
+}
+
+// Run returns the run with the given id, or unique id prefix
+func (j *Journal) Run(id string) (*Run, error) {
+	runs, err := j.Runs()
+	if err != nil {
+		return nil, err
+	}
+	var found *Run
+	for _, r := range runs {
+		if r.ID == id {
+			return r, nil
+		}
+		if strings.HasPrefix(r.ID, id) {
+			if found != nil {
+				return nil, ErrAmbiguous
+			}
+			found = r
+		}
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	return found, nil
+}
+
+// Prune removes the runs the retention does not keep, and returns how
+// many were removed.
+func (j *Journal) Prune(keep Retention, now time.Time) (int, error) {
+	runs, err := j.Runs()
+	if err != nil {
+		return 0, err
+	}
+
+	kept := runs
+	if keep.MaxAge > 0 {
+		kept = kept[:0:0]
+		for _, r := range runs {
+			if now.Sub(r.Started) <= keep.MaxAge {
+				kept = append(kept, r)
+			}
+		}
+	}
+	if keep.MaxRuns > 0 && len(kept) > keep.MaxRuns {
+		kept = kept[len(kept)-keep.MaxRuns:]
+	}
+	removed := len(runs) - len(kept)
+	if removed == 0 {
+		return 0, nil
+	}
+
+	// Rewrite the journal next to the old one, then swap them
+	tmp, err := ioutil.TempFile(filepath.Dir(j.path), fileName)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	for _, r := range kept {
+		data, err := json.Marshal(r)
+		if err != nil {
+			tmp.Close()
+			return 0, err
+		}
+		w.Write(append(data, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	return removed, os.Rename(tmp.Name(), j.path)
+}
@@ -0,0 +1,74 @@
+package journal
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cidan/pepper/plan"
+	"github.com/stretchr/testify/assert"
+)
+
+func testJournal(t *testing.T) (*Journal, func()) {
+	dir, err := ioutil.TempDir("", "journal")
+	assert.Nil(t, err)
+	j, err := Open(dir)
+	assert.Nil(t, err)
+	return j, func() { os.RemoveAll(dir) }
+}
+
+func TestAppendRuns(t *testing.T) {
+	j, cleanup := testJournal(t)
+	defer cleanup()
+
+	report := &plan.Report{
+		Started: time.Now(),
+		Results: []*plan.Result{
+			{Address: "shell.run.a", Status: plan.StatusChanged, Output: strings.Repeat("x", ExcerptSize+10)},
+			{Address: "shell.run.b", Status: plan.StatusFailed, Error: "exit status 1"},
+		},
+	}
+	r := NewRun(report, "hash")
+	assert.Nil(t, j.Append(r))
+	assert.Nil(t, j.Append(NewRun(&plan.Report{Started: time.Now()}, "hash")))
+
+	runs, err := j.Runs()
+	assert.Nil(t, err)
+	assert.Len(t, runs, 2)
+	assert.Equal(t, r.ID, runs[0].ID)
+	assert.Equal(t, plan.StatusFailed, runs[0].States[1].Status)
+	assert.Equal(t, 1, runs[0].Count(plan.StatusChanged))
+	assert.Len(t, runs[0].States[0].Output, ExcerptSize+3)
+
+	found, err := j.Run(r.ID[:len(r.ID)-2])
+	assert.Nil(t, err)
+	assert.Equal(t, r.ID, found.ID)
+
+	_, err = j.Run("nope")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestPrune(t *testing.T) {
+	j, cleanup := testJournal(t)
+	defer cleanup()
+
+	now := time.Now()
+	for _, age := range []time.Duration{72 * time.Hour, 48 * time.Hour, 2 * time.Hour, time.Hour} {
+		assert.Nil(t, j.Append(NewRun(&plan.Report{Started: now.Add(-age)}, "hash")))
+	}
+
+	removed, err := j.Prune(Retention{MaxAge: 50 * time.Hour}, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, removed)
+
+	removed, err = j.Prune(Retention{MaxRuns: 2}, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, removed)
+
+	runs, err := j.Runs()
+	assert.Nil(t, err)
+	assert.Len(t, runs, 2)
+	assert.True(t, now.Sub(runs[0].Started) < 3*time.Hour)
+}
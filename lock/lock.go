@@ -0,0 +1,149 @@
+/*
+Package lock keeps pepper runs from overlapping with an exclusive
+flock on a lock file, which also records who holds it.
+*/
+package lock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// PollInterval is how often a held lock is tried again while waiting
+var PollInterval = 100 * time.Millisecond
+
+// Holder describes the process holding a lock
+type Holder struct {
+	PID     int       `json:"pid"`
+	Command string    `json:"command"`
+	Host    string    `json:"host"`
+	Started time.Time `json:"started"`
+}
+
+func (h *Holder) String() string {
+	return fmt.Sprintf("pid %d (%s) on %s since %s",
+		h.PID, h.Command, h.Host, h.Started.Local().Format(time.RFC1123))
+}
+
+// HeldError is returned when a lock is still held by another process
+// once the wait is over. Holder is nil if it could not be read.
+type HeldError struct {
+	Path   string
+	Holder *Holder
+}
+
+func (e *HeldError) Error() string {
+	if e.Holder == nil {
+		return fmt.Sprintf("lock %s is held by another process", e.Path)
+	}
+	return fmt.Sprintf("lock %s is held by %s", e.Path, e.Holder)
+}
+
+// Lock is an acquired lock
+type Lock struct {
+	f *os.File
+}
+
+// Acquire takes the exclusive lock at path, creating the file if
+// needed, and records this process as its holder. If another process
+// holds the lock, Acquire waits up to wait for it to be released.
+func Acquire(path string, wait time.Duration) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if err != syscall.EWOULDBLOCK || time.Now().After(deadline) {
+			f.Close()
+			if err == syscall.EWOULDBLOCK {
+				return nil, &HeldError{Path: path, Holder: ReadHolder(path)}
+			}
+			return nil, err
+		}
+		time.Sleep(PollInterval)
+	}
+
+	l := &Lock{f: f}
+	if err := l.write(); err != nil {
+		l.Release()
+		return nil, err
+	}
+	return l, nil
+}
+
+// write records this process as the holder of the lock
+func (l *Lock) write() error {
+	host, _ := os.Hostname()
+	b, err := json.Marshal(&Holder{
+		PID:     os.Getpid(),
+		Command: strings.Join(os.Args, " "),
+		Host:    host,
+		Started: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := l.f.Truncate(0); err != nil {
+		return err
+	}
+	_, err = l.f.WriteAt(append(b, '\n'), 0)
+	return err
+}
+
+// Release clears the holder and releases the lock
+func (l *Lock) Release() error {
+	l.f.Truncate(0)
+	return l.f.Close()
+}
+
+// ReadHolder returns the holder recorded in the lock file at path, or
+// nil if there is none.
+func ReadHolder(path string) *Holder {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var h Holder
+	if err := json.Unmarshal(b, &h); err != nil {
+		return nil
+	}
+	return &h
+}
+
+// RecordHolder returns the pid of the process holding a POSIX record
+// lock on the file at path, as dpkg and apt do, or 0 if it is not
+// locked. The lock is only tested, never taken.
+func RecordHolder(path string) (int, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	lk := syscall.Flock_t{Type: syscall.F_WRLCK}
+	if err := syscall.FcntlFlock(f.Fd(), syscall.F_GETLK, &lk); err != nil {
+		return 0, err
+	}
+	if lk.Type == syscall.F_UNLCK {
+		return 0, nil
+	}
+	return int(lk.Pid), nil
+}
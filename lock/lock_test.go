@@ -0,0 +1,46 @@
+package lock
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "run", "pepper.lock")
+
+	l, err := Acquire(path, 0)
+	assert.Nil(t, err)
+	h := ReadHolder(path)
+	if assert.NotNil(t, h) {
+		assert.Equal(t, os.Getpid(), h.PID)
+	}
+
+	// flock locks belong to the open file, so a second acquire in the
+	// same process waits and fails like another process would.
+	started := time.Now()
+	_, err = Acquire(path, 50*time.Millisecond)
+	assert.True(t, time.Since(started) >= 50*time.Millisecond)
+	if held, ok := err.(*HeldError); assert.True(t, ok, "%v", err) {
+		assert.Equal(t, os.Getpid(), held.Holder.PID)
+	}
+
+	assert.Nil(t, l.Release())
+	assert.Nil(t, ReadHolder(path))
+	l, err = Acquire(path, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, l.Release())
+}
+
+func TestRecordHolder(t *testing.T) {
+	pid, err := RecordHolder("testdata/missing")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, pid)
+}
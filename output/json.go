@@ -0,0 +1,36 @@
+package output
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/Cidan/pepper/plan"
+)
+
+// jsonWriter writes a JSON object per line: a state event for every
+// state as it finishes, then a summary event.
+type jsonWriter struct {
+	enc *json.Encoder
+}
+
+type stateEvent struct {
+	Event string `json:"event"`
+	*plan.Result
+}
+
+type summaryEvent struct {
+	Event string `json:"event"`
+	*Summary
+}
+
+func newJSONWriter(w io.Writer) *jsonWriter {
+	return &jsonWriter{enc: json.NewEncoder(w)}
+}
+
+func (j *jsonWriter) Result(r *plan.Result) error {
+	return j.enc.Encode(&stateEvent{"state", r})
+}
+
+func (j *jsonWriter) Finish(report *plan.Report) error {
+	return j.enc.Encode(&summaryEvent{"summary", Summarize(report)})
+}
@@ -0,0 +1,105 @@
+package output
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/Cidan/pepper/address"
+	"github.com/Cidan/pepper/plan"
+)
+
+// junitWriter writes the report as JUnit XML, with a test case per
+// state, so CI systems can show failed states like failed tests.
+type junitWriter struct {
+	w io.Writer
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      string      `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+func (j *junitWriter) Result(r *plan.Result) error {
+	return nil
+}
+
+func (j *junitWriter) Finish(report *plan.Report) error {
+	return WriteJUnit(j.w, "pepper", report)
+}
+
+// WriteJUnit writes the report as a JUnit test suite with the given
+// name. Test cases are grouped by state type and command.
+func WriteJUnit(w io.Writer, name string, report *plan.Report) error {
+	suite := junitSuite{
+		Name:      name,
+		Tests:     len(report.Results),
+		Time:      seconds(report.Duration.Seconds()),
+		Timestamp: report.Started.UTC().Format("2006-01-02T15:04:05"),
+	}
+	for _, r := range report.Results {
+		c := junitCase{
+			Name:      r.Address,
+			Classname: classname(r.Address),
+			Time:      seconds(r.Duration.Seconds()),
+			SystemOut: r.Output,
+		}
+		switch r.Status {
+		case plan.StatusFailed:
+			suite.Failures++
+			c.Failure = &junitMessage{Message: r.Error, Body: r.Error}
+		case plan.StatusSkipped:
+			suite.Skipped++
+			c.Skipped = &junitMessage{Message: r.Comment}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(&junitSuites{Suites: []junitSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// classname returns the type and command of a state address
+func classname(addr string) string {
+	a, err := address.Parse(addr)
+	if err != nil {
+		return addr
+	}
+	return a.Type + "." + a.Command
+}
+
+func seconds(s float64) string {
+	return fmt.Sprintf("%.3f", s)
+}
@@ -0,0 +1,88 @@
+/*
+Package output renders the results of a run for people and tools: a
+summary table, a stream of JSON events or a JUnit XML report.
+*/
+package output
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/Cidan/pepper/plan"
+)
+
+// Formats supported by New
+var Formats = []string{"text", "json", "junit"}
+
+// SlowestCount is how many of the slowest states a summary lists
+const SlowestCount = 5
+
+// Writer renders a run. Result is called with every state as soon as
+// it finishes, and Finish once with the whole report.
+type Writer interface {
+	Result(r *plan.Result) error
+	Finish(report *plan.Report) error
+}
+
+// New returns a writer of the format, writing to w
+func New(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case "text":
+		return &textWriter{w: w}, nil
+	case "json":
+		return newJSONWriter(w), nil
+	case "junit":
+		return &junitWriter{w: w}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
+
+// Summary counts the results of a run
+type Summary struct {
+	OK        int           `json:"ok"`
+	Changed   int           `json:"changed"`
+	Failed    int           `json:"failed"`
+	Skipped   int           `json:"skipped"`
+	Started   time.Time     `json:"started"`
+	Duration  time.Duration `json:"duration"`
+	Cancelled bool          `json:"cancelled,omitempty"`
+	Reboot    string        `json:"reboot,omitempty"`
+	// Slowest states that ran, slowest first
+	Slowest []*Timing `json:"slowest,omitempty"`
+}
+
+// Timing is how long a single state took
+type Timing struct {
+	Address  string        `json:"address"`
+	Status   plan.Status   `json:"status"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Summarize counts the results of the report and finds the slowest
+// states.
+func Summarize(report *plan.Report) *Summary {
+	s := &Summary{
+		OK:        report.Count(plan.StatusOK),
+		Changed:   report.Count(plan.StatusChanged),
+		Failed:    report.Count(plan.StatusFailed),
+		Skipped:   report.Count(plan.StatusSkipped),
+		Started:   report.Started,
+		Duration:  report.Duration,
+		Cancelled: report.Cancelled,
+		Reboot:    report.Reboot,
+	}
+	for _, r := range report.Results {
+		if r.Duration > 0 {
+			s.Slowest = append(s.Slowest, &Timing{r.Address, r.Status, r.Duration})
+		}
+	}
+	sort.SliceStable(s.Slowest, func(i, j int) bool {
+		return s.Slowest[i].Duration > s.Slowest[j].Duration
+	})
+	if len(s.Slowest) > SlowestCount {
+		s.Slowest = s.Slowest[:SlowestCount]
+	}
+	return s
+}
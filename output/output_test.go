@@ -0,0 +1,83 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cidan/pepper/plan"
+	"github.com/stretchr/testify/assert"
+)
+
+func testReport() *plan.Report {
+	return &plan.Report{
+		Started:  time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Duration: 3 * time.Second,
+		Results: []*plan.Result{
+			{Address: "apt.install.base", Status: plan.StatusChanged, Duration: 2 * time.Second, Output: "installed"},
+			{Address: "shell.run.broken", Status: plan.StatusFailed, Error: "exit status 1", Duration: time.Second},
+			{Address: "shell.run.after", Status: plan.StatusSkipped, Comment: "no onchanges requisite changed"},
+		},
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	s := Summarize(testReport())
+	assert.Equal(t, 0, s.OK)
+	assert.Equal(t, 1, s.Changed)
+	assert.Equal(t, 1, s.Failed)
+	assert.Equal(t, 1, s.Skipped)
+	if assert.Len(t, s.Slowest, 2) {
+		assert.Equal(t, "apt.install.base", s.Slowest[0].Address)
+	}
+}
+
+func TestText(t *testing.T) {
+	var b bytes.Buffer
+	w, err := New("text", &b)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Finish(testReport()))
+	assert.Contains(t, b.String(), "OK  CHANGED  FAILED  SKIPPED  DURATION\n0   1        1       1        3s\n")
+	assert.Contains(t, b.String(), "apt.install.base  changed  2s\n")
+}
+
+func TestJSON(t *testing.T) {
+	var b bytes.Buffer
+	w, err := New("json", &b)
+	assert.Nil(t, err)
+	report := testReport()
+	for _, r := range report.Results {
+		assert.Nil(t, w.Result(r))
+	}
+	assert.Nil(t, w.Finish(report))
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	assert.Len(t, lines, 4)
+	var state map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(lines[1]), &state))
+	assert.Equal(t, "state", state["event"])
+	assert.Equal(t, "shell.run.broken", state["address"])
+	assert.Equal(t, "failed", state["status"])
+	var summary map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(lines[3]), &summary))
+	assert.Equal(t, "summary", summary["event"])
+	assert.Equal(t, 1.0, summary["failed"])
+}
+
+func TestJUnit(t *testing.T) {
+	var b bytes.Buffer
+	w, err := New("junit", &b)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Finish(testReport()))
+	assert.Contains(t, b.String(), `<testsuite name="pepper" tests="3" failures="1" skipped="1" time="3.000" timestamp="2026-01-02T03:04:05">`)
+	assert.Contains(t, b.String(), `<testcase name="shell.run.broken" classname="shell.run" time="1.000">`)
+	assert.Contains(t, b.String(), `<failure message="exit status 1">exit status 1</failure>`)
+	assert.Contains(t, b.String(), `<skipped message="no onchanges requisite changed"></skipped>`)
+}
+
+func TestUnknownFormat(t *testing.T) {
+	_, err := New("yaml", &bytes.Buffer{})
+	assert.Error(t, err)
+}
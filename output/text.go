@@ -0,0 +1,40 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Cidan/pepper/plan"
+)
+
+// textWriter prints a summary table once the run is over. States are
+// already logged as they finish.
+type textWriter struct {
+	w io.Writer
+}
+
+func (t *textWriter) Result(r *plan.Result) error {
+	return nil
+}
+
+func (t *textWriter) Finish(report *plan.Report) error {
+	s := Summarize(report)
+	w := tabwriter.NewWriter(t.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "\nOK\tCHANGED\tFAILED\tSKIPPED\tDURATION")
+	fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%s\n", s.OK, s.Changed, s.Failed, s.Skipped, s.Duration.Round(time.Millisecond))
+	if len(s.Slowest) > 0 {
+		fmt.Fprintln(w, "\nSLOWEST\tSTATUS\tDURATION")
+		for _, r := range s.Slowest {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", r.Address, r.Status, r.Duration.Round(time.Millisecond))
+		}
+	}
+	if s.Cancelled {
+		fmt.Fprintln(w, "\nThe run was cancelled before every state ran.")
+	}
+	if s.Reboot != "" {
+		fmt.Fprintf(w, "\n%s asked for a reboot, the run stopped there.\n", s.Reboot)
+	}
+	return w.Flush()
+}
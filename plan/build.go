@@ -0,0 +1,130 @@
+package plan
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/Cidan/pepper/address"
+	"github.com/Cidan/pepper/states"
+)
+
+// Attrs are the attributes of a state declared in code. They may use
+// any of the reserved attributes in Meta, such as requires, alongside
+// the attributes of the state type.
+type Attrs map[string]interface{}
+
+// added is a state declared in code, waiting for Generate
+type added struct {
+	addr  address.Address
+	attrs Attrs
+	file  string
+	line  int
+}
+
+// Add declares the state at addr, which is type.command.name, as if it
+// had been read from a state file. States declared in code and states
+// read from files may depend on each other, and are validated the same
+// way by Generate. Values may be any Go bool, number, string, slice or
+// map of them.
+func (s *Plan) Add(addr string, attrs Attrs) error {
+	return s.add(addr, attrs, 2)
+}
+
+// add declares a state, recording the caller skip frames up as where
+// it was declared.
+func (s *Plan) add(addr string, attrs Attrs, skip int) error {
+	a, err := address.Parse(addr)
+	if err != nil {
+		return err
+	}
+	if len(a.Module) > 0 || a.Index != address.NoIndex {
+		return fmt.Errorf("%s: states must be added as type.command.name", addr)
+	}
+
+	// Errors point at the code that declared the state
+	_, file, line, _ := runtime.Caller(skip)
+
+	n := Attrs{}
+	for k, v := range attrs {
+		n[k] = normalize(reflect.ValueOf(v))
+	}
+	s.added = append(s.added, &added{a, n, file, line})
+	return nil
+}
+
+// AddState declares the state at addr from a value of its state type,
+// such as &states.Apt{Packages: []string{"curl"}}. Fields left at their
+// zero value take the default of their attribute. meta holds reserved
+// attributes, such as requires, and may be nil.
+func (s *Plan) AddState(addr string, state states.States, meta Attrs) error {
+	a, err := address.Parse(addr)
+	if err != nil {
+		return err
+	}
+	if v := reflect.ValueOf(state); state == nil || v.Kind() == reflect.Ptr && v.IsNil() {
+		return fmt.Errorf("%s: state is nil", addr)
+	}
+	if def, ok := states.Lookup(a.Type); ok {
+		want := reflect.TypeOf(def.New(a.Command))
+		if got := reflect.TypeOf(state); got != want {
+			return fmt.Errorf("%s: state is a %s, not a %s", addr, got, want)
+		}
+	}
+
+	attrs := Attrs{}
+	for k, v := range meta {
+		attrs[k] = v
+	}
+	rv := reflect.Indirect(reflect.ValueOf(state))
+	for i := 0; i < rv.NumField(); i++ {
+		f := rv.Type().Field(i)
+		name := strings.Split(f.Tag.Get("mapstructure"), ",")[0]
+		if f.PkgPath != "" || name == "-" || rv.Field(i).IsZero() {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		attrs[name] = rv.Field(i).Interface()
+	}
+	return s.add(addr, attrs, 2)
+}
+
+// normalize converts a Go value to the types HCL decodes to, which is
+// what state schemas validate.
+func normalize(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return normalize(v.Elem())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.Slice, reflect.Array:
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = normalize(v.Index(i))
+		}
+		return out
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return v.Interface()
+		}
+		out := make(map[string]interface{}, v.Len())
+		for _, k := range v.MapKeys() {
+			out[k.String()] = normalize(v.MapIndex(k))
+		}
+		return out
+	}
+	return v.Interface()
+}
@@ -0,0 +1,76 @@
+package plan
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Cidan/pepper/states"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdd(t *testing.T) {
+	p := New()
+	assert.Nil(t, p.ReadFile("testdata/valid/events.hcl"))
+	assert.Nil(t, p.Add("test.run.code", Attrs{
+		"changed":  true,
+		"requires": []string{"test.run.first"},
+		"tags":     []string{"code"},
+	}))
+	assert.Nil(t, p.AddState("shell.run.hello", &states.Shell{Cmd: "true"}, Attrs{
+		"requires": "tag:code",
+	}))
+	assert.Nil(t, p.Generate())
+	assert.Equal(t, []string{"test.run.first", "test.run.second", "test.run.code", "shell.run.hello"},
+		executionOrder(t, p))
+
+	report, err := p.Execute(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, report.Count(StatusChanged))
+}
+
+func TestAddInvalid(t *testing.T) {
+	var tests = []struct {
+		add func(p *Plan) error
+		err string
+	}{
+		{func(p *Plan) error {
+			return p.Add("shell.run.args", Attrs{"cmd": "echo", "args": "hello"})
+		}, `shell.run.args: attribute "args" must be a list, got string`},
+		{func(p *Plan) error {
+			return p.Add("shell.run.missing", Attrs{"requires": "apt.install.nothing", "cmd": "true"})
+		}, `unable to find 'requires' state 'apt.install.nothing', which shell.run.missing depends on`},
+		{func(p *Plan) error {
+			return p.AddState("apt.install.shell", &states.Shell{Cmd: "true"}, nil)
+		}, `apt.install.shell: state is a *states.Shell, not a *states.Apt`},
+		{func(p *Plan) error {
+			return p.AddState("shell.run.nil", nil, nil)
+		}, `shell.run.nil: state is nil`},
+		{func(p *Plan) error {
+			var sh *states.Shell
+			return p.AddState("shell.run.typed_nil", sh, nil)
+		}, `shell.run.typed_nil: state is nil`},
+		{func(p *Plan) error {
+			return p.Add("module.web.shell.run.x", Attrs{"cmd": "true"})
+		}, `module.web.shell.run.x: states must be added as type.command.name`},
+	}
+
+	for _, test := range tests {
+		p := New()
+		err := test.add(p)
+		if err == nil {
+			err = p.Generate()
+		}
+		if assert.Error(t, err) {
+			assert.Equal(t, test.err, err.Error())
+		}
+	}
+}
+
+func TestAddLocation(t *testing.T) {
+	p := New()
+	assert.Nil(t, p.Add("test.run.here", nil))
+	assert.Nil(t, p.Generate())
+	v := p.vertex("test.run.here")
+	assert.True(t, strings.HasSuffix(v.file, "build_test.go"), v.file)
+}
@@ -0,0 +1,71 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Cidan/pepper/states"
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog/log"
+)
+
+// Change is the predicted outcome of applying a single state.
+// Attributes names what would change, when the state can tell. Error
+// is set if the state could not be checked, and Unknown if it cannot
+// tell whether the system matches it.
+type Change struct {
+	Address    string
+	Changed    bool
+	Comment    string
+	Attributes []string `json:",omitempty"`
+	Tags       []string `json:",omitempty"`
+	Error      string   `json:",omitempty"`
+	Unknown    bool     `json:",omitempty"`
+}
+
+// Check predicts what executing the plan would change without
+// changing anything, and returns a change for every state in the
+// order they would run. Requisites are not evaluated, since whether
+// a state would be skipped depends on what its requisites do.
+// Assertions are left out, since they only hold once applied. A state
+// that cannot be checked does not stop the others from being checked,
+// and the error lists every such state.
+func (s *Plan) Check(ctx context.Context) ([]*Change, error) {
+	order, err := s.graph.Sort(less)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []*Change
+	var failed *multierror.Error
+	for _, vertex := range order {
+		v, ok := vertex.(*astVertex)
+		if !ok || v.isAssertion() {
+			continue
+		}
+		log.Debug().Str("state", v.String()).Msg("Checking state")
+		res, err := v.check(ctx)
+		if err != nil {
+			failed = multierror.Append(failed, fmt.Errorf("%s: %s", v, err))
+			changes = append(changes, &Change{Address: v.String(), Tags: v.tags, Error: err.Error()})
+			continue
+		}
+		changes = append(changes, &Change{
+			Address:    v.String(),
+			Changed:    res.Changed,
+			Comment:    res.Comment,
+			Attributes: res.Changes,
+			Tags:       v.tags,
+			Unknown:    res.Unknown,
+		})
+	}
+	return changes, failed.ErrorOrNil()
+}
+
+// check runs Check on the state within its timeout
+func (v *astVertex) check(ctx context.Context) (*states.Result, error) {
+	ctx, cancel := v.withTimeout(ctx)
+	defer cancel()
+	res, err := v.states.Check(ctx)
+	return res, v.timedOut(ctx, err)
+}
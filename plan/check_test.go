@@ -0,0 +1,22 @@
+package plan
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckContinues(t *testing.T) {
+	p := New()
+	assert.Nil(t, p.ReadFile("testdata/valid/check.hcl"))
+	assert.Nil(t, p.Generate())
+	changes, err := p.Check(context.Background())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "test.run.broken: unable to check")
+	}
+	if assert.Len(t, changes, 2) {
+		assert.Equal(t, &Change{Address: "test.run.broken", Tags: []string{"db"}, Error: "unable to check"}, changes[0])
+		assert.True(t, changes[1].Changed)
+	}
+}
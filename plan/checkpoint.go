@@ -0,0 +1,110 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Checkpoint records the states a run has completed, so that a run
+// that dies halfway, or stops for a reboot, can be resumed without
+// applying them again.
+type Checkpoint struct {
+	path string
+
+	ConfigHash string `json:"config_hash"`
+	// Reboot is the state that asked for a reboot, if the run stopped
+	// for one.
+	Reboot  string             `json:"reboot,omitempty"`
+	Results map[string]*Result `json:"results"`
+}
+
+// NewCheckpoint starts a new checkpoint at path for a run of the
+// config with the given hash, replacing any previous checkpoint.
+func NewCheckpoint(path, configHash string) *Checkpoint {
+	return &Checkpoint{
+		path:       path,
+		ConfigHash: configHash,
+		Results:    map[string]*Result{},
+	}
+}
+
+// ResumeCheckpoint reads the checkpoint at path to resume a run of the
+// config with the given hash. Resuming a run of a different config is
+// an error, while a missing checkpoint starts a new one.
+func ResumeCheckpoint(path, configHash string) (*Checkpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return NewCheckpoint(path, configHash), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Checkpoint{path: path}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %s", path, err)
+	}
+	if c.ConfigHash != configHash {
+		return nil, fmt.Errorf("checkpoint %s is for different state files, run without resuming", path)
+	}
+	if c.Results == nil {
+		c.Results = map[string]*Result{}
+	}
+	return c, nil
+}
+
+// done returns the result of a state that succeeded before
+func (c *Checkpoint) done(addr string) (*Result, bool) {
+	r, ok := c.Results[addr]
+	if !ok || r.Status == StatusFailed {
+		return nil, false
+	}
+	return r, true
+}
+
+// record saves the result of a state
+func (c *Checkpoint) record(r *Result) error {
+	c.Results[r.Address] = r
+	return c.save()
+}
+
+// save writes the checkpoint next to its path and renames it into
+// place, so a crash never leaves a partial checkpoint behind.
+func (c *Checkpoint) save() error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// Remove deletes the checkpoint, once a run has completed
+func (c *Checkpoint) Remove() error {
+	err := os.Remove(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
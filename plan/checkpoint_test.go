@@ -0,0 +1,49 @@
+package plan
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint.json")
+
+	p := New()
+	assert.Nil(t, p.ReadFile("testdata/valid/reboot.hcl"))
+	assert.Nil(t, p.Generate())
+
+	// The run stops at the state asking for a reboot
+	p.SetCheckpoint(NewCheckpoint(path, p.Hash()))
+	report, err := p.Execute(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "test.run.kernel", report.Reboot)
+	assert.Len(t, report.Results, 2)
+
+	_, err = ResumeCheckpoint(path, "other")
+	assert.Error(t, err)
+
+	// Resuming skips both completed states and runs the rest
+	c, err := ResumeCheckpoint(path, p.Hash())
+	assert.Nil(t, err)
+	assert.Equal(t, "test.run.kernel", c.Reboot)
+	p.SetCheckpoint(c)
+	report, err = p.Execute(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "", report.Reboot)
+	assert.Len(t, report.Results, 3)
+	assert.Equal(t, StatusChanged, report.Results[1].Status)
+	assert.Equal(t, "completed before resuming", report.Results[1].Comment)
+	assert.Equal(t, StatusOK, report.Results[2].Status)
+
+	// A completed run removes its checkpoint
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,133 @@
+package plan
+
+import (
+	"sync"
+	"time"
+)
+
+// Event is published by a plan as it is generated and executed. It is
+// one of *PlanGenerated, *StateStarted, *OutputLine, *StateFinished or
+// *RunFinished.
+type Event interface {
+	isEvent()
+}
+
+// PlanGenerated is published once Generate has resolved every state
+type PlanGenerated struct {
+	Time time.Time
+	// States in the order they were declared
+	States []string
+}
+
+// StateStarted is published when a state starts running
+type StateStarted struct {
+	Time    time.Time
+	Address string
+}
+
+// OutputLine is a line printed by a command of a running state
+type OutputLine struct {
+	Time    time.Time
+	Address string
+	Line    string
+}
+
+// StateFinished is published with the result of every state in the
+// report, including states skipped without being started.
+type StateFinished struct {
+	Time   time.Time
+	Result *Result
+}
+
+// RunFinished is published with the report once Execute is done
+type RunFinished struct {
+	Time   time.Time
+	Report *Report
+}
+
+func (*PlanGenerated) isEvent() {}
+func (*StateStarted) isEvent()  {}
+func (*OutputLine) isEvent()    {}
+func (*StateFinished) isEvent() {}
+func (*RunFinished) isEvent()   {}
+
+// Subscriber receives the events of a plan. Events are delivered one
+// at a time, in the order they happened, and Event must not subscribe
+// or unsubscribe from the same plan.
+type Subscriber interface {
+	Event(e Event)
+}
+
+// SubscriberFunc is a function receiving events
+type SubscriberFunc func(e Event)
+
+// Event calls f(e)
+func (f SubscriberFunc) Event(e Event) {
+	f(e)
+}
+
+// bus delivers events to subscribers. It is safe for concurrent use.
+type bus struct {
+	mu   sync.Mutex
+	next int
+	subs []subscription
+}
+
+type subscription struct {
+	id  int
+	sub Subscriber
+}
+
+// Subscribe has sub receive every event published from now on, until
+// the returned function is called.
+func (s *Plan) Subscribe(sub Subscriber) func() {
+	b := s.events
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.next++
+	id := b.next
+	b.subs = append(b.subs, subscription{id, sub})
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, e := range b.subs {
+			if e.id == id {
+				b.subs = append(b.subs[:i:i], b.subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Events returns a channel receiving every event published from now
+// on, and a function that stops the subscription and closes the
+// channel. Execute waits for events to be received once the buffer is
+// full, until the subscription is stopped.
+func (s *Plan) Events(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	done := make(chan struct{})
+	unsubscribe := s.Subscribe(SubscriberFunc(func(e Event) {
+		select {
+		case ch <- e:
+		case <-done:
+		}
+	}))
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			close(done)
+			unsubscribe()
+			close(ch)
+		})
+	}
+}
+
+// publish delivers e to every subscriber
+func (s *Plan) publish(e Event) {
+	b := s.events
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, sub := range b.subs {
+		sub.sub.Event(e)
+	}
+}
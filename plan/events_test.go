@@ -0,0 +1,71 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribe(t *testing.T) {
+	p := New()
+	var events []string
+	unsubscribe := p.Subscribe(SubscriberFunc(func(e Event) {
+		switch e := e.(type) {
+		case *PlanGenerated:
+			events = append(events, fmt.Sprintf("generated %v", e.States))
+		case *StateStarted:
+			events = append(events, "started "+e.Address)
+		case *OutputLine:
+			events = append(events, e.Address+": "+e.Line)
+		case *StateFinished:
+			events = append(events, fmt.Sprintf("finished %s %s", e.Result.Address, e.Result.Status))
+		case *RunFinished:
+			events = append(events, fmt.Sprintf("run finished %d", len(e.Report.Results)))
+		}
+	}))
+	assert.Nil(t, p.ReadFile("testdata/valid/events.hcl"))
+	assert.Nil(t, p.Generate())
+	_, err := p.Execute(context.Background())
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{
+		"generated [test.run.first test.run.second]",
+		"started test.run.first",
+		"test.run.first: hello",
+		"finished test.run.first ok",
+		"started test.run.second",
+		"finished test.run.second ok",
+		"run finished 2",
+	}, events)
+
+	unsubscribe()
+	events = nil
+	p.Execute(context.Background())
+	assert.Nil(t, events)
+}
+
+func TestEvents(t *testing.T) {
+	p := New()
+	assert.Nil(t, p.ReadFile("testdata/valid/events.hcl"))
+	assert.Nil(t, p.Generate())
+
+	// An unbuffered channel is read while the plan executes
+	ch, stop := p.Events(0)
+	done := make(chan int)
+	go func() {
+		n := 0
+		for e := range ch {
+			n++
+			if _, ok := e.(*RunFinished); ok {
+				stop()
+			}
+		}
+		done <- n
+	}()
+	_, err := p.Execute(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 6, <-done)
+	stop()
+}
@@ -0,0 +1,388 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Cidan/pepper/action"
+	"github.com/Cidan/pepper/graph"
+	"github.com/Cidan/pepper/states"
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog/log"
+)
+
+// Status of a state once the plan has been executed
+type Status int
+
+const (
+	StatusOK Status = iota
+	StatusChanged
+	StatusFailed
+	StatusSkipped
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusOK:
+		return "ok"
+	case StatusChanged:
+		return "changed"
+	case StatusFailed:
+		return "failed"
+	case StatusSkipped:
+		return "skipped"
+	}
+	return "unknown"
+}
+
+// MarshalText encodes the status by name
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a status encoded by MarshalText
+func (s *Status) UnmarshalText(text []byte) error {
+	for _, st := range []Status{StatusOK, StatusChanged, StatusFailed, StatusSkipped} {
+		if st.String() == string(text) {
+			*s = st
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown status %q", text)
+}
+
+// Result of executing a single state
+type Result struct {
+	Address  string        `json:"address"`
+	Status   Status        `json:"status"`
+	Comment  string        `json:"comment,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Output   string        `json:"output,omitempty"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	Reboot   bool          `json:"reboot,omitempty"`
+	// Attempts is the number of times the state ran, if it ran
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// Report is the result of every state executed, in execution order
+type Report struct {
+	Started  time.Time
+	Duration time.Duration
+	Results  []*Result
+	// Reboot is the state that asked for a reboot, which stops the
+	// run until it is resumed.
+	Reboot string
+	// Cancelled is set if the run was cancelled before every state
+	// ran. States that did not start are reported as skipped.
+	Cancelled bool
+}
+
+// Count returns the number of states that ended with the status
+func (r *Report) Count(status Status) int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Err returns an error listing every failed state, or nil
+func (r *Report) Err() error {
+	var failed *multierror.Error
+	for _, res := range r.Results {
+		if res.Status == StatusFailed {
+			failed = multierror.Append(failed, fmt.Errorf("%s: %s", res.Address, res.Error))
+		}
+	}
+	return failed.ErrorOrNil()
+}
+
+// Execute the plan, applying every state after the states it depends
+// on. Requisites decide whether a state runs at all. Assertions run
+// once every other state has. The report is returned along with an
+// error listing every failed state, if any.
+//
+// Once ctx is done no further state is started, and the state that
+// is running is stopped. The report then covers the partial run.
+func (s *Plan) Execute(ctx context.Context) (*Report, error) {
+	order, err := s.graph.Sort(less)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Started: time.Now()}
+	s.results = map[*astVertex]*Result{}
+	for _, v := range stateVertices(order) {
+		if v.isAssertion() {
+			continue
+		}
+		if r, ok := s.resumed(v); ok {
+			s.results[v] = r
+			s.report(report, r)
+			continue
+		}
+		if s.cancelled(ctx, v, report) {
+			continue
+		}
+
+		r := s.run(ctx, v, report, s.executeVertex)
+		if s.checkpoint != nil {
+			if err := s.checkpoint.record(r); err != nil {
+				log.Warn().Err(err).Msg("Unable to write checkpoint")
+			}
+		}
+		if r.Reboot {
+			report.Reboot = r.Address
+			log.Warn().Str("state", r.Address).Msg("State requested a reboot, stopping until the run is resumed")
+			break
+		}
+	}
+	if report.Reboot == "" {
+		s.runAssertions(ctx, order, report, s.executeVertex)
+	}
+	report.Duration = time.Since(report.Started)
+	s.finishCheckpoint(report)
+	s.publish(&RunFinished{Time: time.Now(), Report: report})
+	return report, report.Err()
+}
+
+// stateVertices returns the states among vertices, in order
+func stateVertices(vertices []graph.Vertex) []*astVertex {
+	var out []*astVertex
+	for _, vertex := range vertices {
+		if v, ok := vertex.(*astVertex); ok {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// cancelled reports v as skipped and returns true if ctx is done
+func (s *Plan) cancelled(ctx context.Context, v *astVertex, report *Report) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+	if !report.Cancelled {
+		log.Warn().Msg("Run cancelled, skipping the remaining states")
+	}
+	report.Cancelled = true
+	r := skipped("run cancelled")
+	r.Address = v.String()
+	s.report(report, r)
+	return true
+}
+
+// run runs a single state with fn, and reports and logs its result
+func (s *Plan) run(ctx context.Context, v *astVertex, report *Report, fn func(context.Context, *astVertex) *Result) *Result {
+	log.Info().Str("state", v.String()).Msg("Executing state")
+	started := time.Now()
+	s.publish(&StateStarted{Time: started, Address: v.String()})
+	r := fn(s.withOutput(ctx, v), v)
+	r.Address = v.String()
+	r.Started = started
+	r.Duration = time.Since(started)
+	s.results[v] = r
+	s.report(report, r)
+
+	e := log.Info()
+	if r.Status == StatusFailed {
+		e = log.Error().Str("error", r.Error)
+	}
+	e.Str("state", r.Address).
+		Str("result", r.Status.String()).
+		Str("comment", r.Comment).
+		Dur("duration", r.Duration).
+		Int("attempts", r.Attempts).
+		Msg("State finished")
+	return r
+}
+
+// report adds the result of a state to the report
+func (s *Plan) report(report *Report, r *Result) {
+	report.Results = append(report.Results, r)
+	s.publish(&StateFinished{Time: time.Now(), Result: r})
+}
+
+// withOutput returns a context that publishes every line printed by
+// the commands of v.
+func (s *Plan) withOutput(ctx context.Context, v *astVertex) context.Context {
+	addr := v.String()
+	return action.WithOutput(ctx, func(line string) {
+		s.publish(&OutputLine{Time: time.Now(), Address: addr, Line: line})
+	})
+}
+
+// resumed returns the result of a state completed by the run being
+// resumed, if any.
+func (s *Plan) resumed(v *astVertex) (*Result, bool) {
+	if s.checkpoint == nil {
+		return nil, false
+	}
+	prev, ok := s.checkpoint.done(v.String())
+	if !ok {
+		return nil, false
+	}
+	r := *prev
+	r.Reboot = false
+	r.Comment = strings.TrimSuffix("completed before resuming; "+r.Comment, "; ")
+	log.Info().Str("state", v.String()).Str("result", r.Status.String()).Msg("Skipping state completed before resuming")
+	return &r, true
+}
+
+// finishCheckpoint removes the checkpoint of a run that completed, or
+// marks why the run stopped otherwise.
+func (s *Plan) finishCheckpoint(report *Report) {
+	c := s.checkpoint
+	if c == nil {
+		return
+	}
+	var err error
+	switch {
+	case report.Reboot != "":
+		c.Reboot = report.Reboot
+		err = c.save()
+	case report.Cancelled:
+		err = c.save()
+	case report.Err() == nil:
+		err = c.Remove()
+	}
+	if err != nil {
+		log.Warn().Err(err).Msg("Unable to update checkpoint")
+	}
+}
+
+// failed returns the result of a state that failed with err
+func failed(err error) *Result {
+	return &Result{Status: StatusFailed, Error: err.Error()}
+}
+
+// skipped returns the result of a state that did not run
+func skipped(comment string) *Result {
+	return &Result{Status: StatusSkipped, Comment: comment}
+}
+
+// executeVertex decides from the results of its requisites whether a
+// state should run, and runs it within its timeout.
+func (s *Plan) executeVertex(ctx context.Context, v *astVertex) *Result {
+	var watched, onchanges, changed, onfail, depFailed bool
+	for _, dep := range s.parents(v) {
+		r, ok := s.results[dep]
+		if !ok {
+			return failed(fmt.Errorf("requisite %s did not run", dep))
+		}
+		for _, kind := range s.graph.EdgeKinds(dep, v) {
+			switch kind {
+			case kindRequire, kindWatch, kindPrereq:
+				if r.Status == StatusFailed {
+					return failed(fmt.Errorf("requisite %s failed", dep))
+				}
+				watched = watched || (kind == kindWatch && r.Status == StatusChanged)
+			case kindOnchanges:
+				onchanges = true
+				changed = changed || r.Status == StatusChanged
+			case kindOnfail:
+				onfail = true
+				depFailed = depFailed || r.Status == StatusFailed
+			}
+		}
+	}
+	if onchanges && !changed {
+		return skipped("no onchanges requisite changed")
+	}
+	if onfail && !depFailed {
+		return skipped("no onfail requisite failed")
+	}
+
+	run, err := s.checkPrereq(ctx, v)
+	if err != nil {
+		return failed(err)
+	}
+	if !run {
+		return skipped("no prereq state is about to change")
+	}
+
+	res, attempts, err := v.execute(ctx)
+	if err != nil {
+		r := failed(err)
+		r.Attempts = attempts
+		return r
+	}
+	if watched {
+		if w, ok := v.states.(states.Watcher); ok {
+			wctx, cancel := v.withTimeout(ctx)
+			defer cancel()
+			wres, err := w.Watch(wctx)
+			if err != nil {
+				return failed(v.timedOut(wctx, err))
+			}
+			res.Changed = res.Changed || wres.Changed
+			res.Comment = strings.TrimPrefix(res.Comment+"; "+wres.Comment, "; ")
+			res.Output += wres.Output
+		}
+	}
+	r := &Result{
+		Status:   StatusOK,
+		Comment:  res.Comment,
+		Output:   res.Output,
+		Reboot:   res.Reboot,
+		Attempts: attempts,
+	}
+	if res.Changed {
+		r.Status = StatusChanged
+		r.Reboot = r.Reboot || v.reboot
+	}
+	return r
+}
+
+// checkPrereq returns true if v has no prereq requisites, or if any
+// of the states it is a prereq of is about to change.
+func (s *Plan) checkPrereq(ctx context.Context, v *astVertex) (bool, error) {
+	prereqs := false
+	for _, c := range s.graph.Children(v) {
+		target, ok := c.(*astVertex)
+		if !ok || !hasKind(s.graph.EdgeKinds(v, target), kindPrereq) {
+			continue
+		}
+		prereqs = true
+		res, err := target.check(ctx)
+		if err != nil {
+			return false, fmt.Errorf("prereq %s: %s", target, err)
+		}
+		if res.Changed {
+			return true, nil
+		}
+	}
+	return !prereqs, nil
+}
+
+func hasKind(kinds []string, kind string) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// withTimeout returns a context that is done once the state has run
+// for longer than its timeout, if it has one.
+func (v *astVertex) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if v.timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, v.timeout)
+}
+
+// timedOut replaces err with a clearer one if the state was stopped
+// because it ran past its timeout.
+func (v *astVertex) timedOut(ctx context.Context, err error) error {
+	if err != nil && v.timeout > 0 && ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", v.timeout)
+	}
+	return err
+}
@@ -0,0 +1,218 @@
+package plan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Cidan/pepper/action"
+	"github.com/Cidan/pepper/schema"
+	"github.com/Cidan/pepper/states"
+	"github.com/stretchr/testify/assert"
+)
+
+// testState is a state type that changes, fails or runs for a while
+// on demand, and always changes when it is watched. A flaky state
+// fails with the exit code exit the first flaky times it runs. Echo
+// is printed with echo, through the command runner.
+type testState struct {
+	Echo    string `mapstructure:"echo"`
+	Changed bool   `mapstructure:"changed"`
+	Fail    bool   `mapstructure:"fail"`
+	Sleep   string `mapstructure:"sleep"`
+	Flaky   int    `mapstructure:"flaky"`
+	Exit    int    `mapstructure:"exit"`
+	// CheckFail makes Check fail
+	CheckFail bool `mapstructure:"check_fail"`
+	runs      int
+}
+
+// exitError is returned by flaky test states
+type exitError int
+
+func (e exitError) Error() string { return fmt.Sprintf("exit status %d", int(e)) }
+func (e exitError) ExitCode() int { return int(e) }
+
+func init() {
+	states.Register(&states.Definition{
+		Name: "test",
+		Commands: []*schema.State{
+			{
+				Command: "run",
+				Schema: map[string]*schema.Schema{
+					"changed":    {Type: schema.TypeBool, Optional: true},
+					"fail":       {Type: schema.TypeBool, Optional: true},
+					"sleep":      {Type: schema.TypeString, Optional: true},
+					"echo":       {Type: schema.TypeString, Optional: true},
+					"flaky":      {Type: schema.TypeInt, Optional: true},
+					"exit":       {Type: schema.TypeInt, Optional: true, Default: 1},
+					"check_fail": {Type: schema.TypeBool, Optional: true},
+				},
+			},
+		},
+		New: func(command string) states.States {
+			return &testState{}
+		},
+	})
+}
+
+func (t *testState) Merge(b states.States) {}
+
+func (t *testState) Check(ctx context.Context) (*states.Result, error) {
+	if t.CheckFail {
+		return nil, errors.New("unable to check")
+	}
+	if t.Changed {
+		return &states.Result{Changed: true, Changes: []string{"changed"}}, nil
+	}
+	return &states.Result{}, nil
+}
+
+func (t *testState) Execute(ctx context.Context) (*states.Result, error) {
+	if t.Fail {
+		return nil, errors.New("failed on purpose")
+	}
+	if t.runs++; t.runs <= t.Flaky {
+		return nil, exitError(t.Exit)
+	}
+	if t.Echo != "" {
+		out, err := action.FromContext(ctx).Run(ctx, "echo", t.Echo)
+		return &states.Result{Changed: t.Changed, Output: string(out)}, err
+	}
+	if t.Sleep != "" {
+		d, _ := time.ParseDuration(t.Sleep)
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return &states.Result{Changed: t.Changed}, nil
+}
+
+func (t *testState) Watch(ctx context.Context) (*states.Result, error) {
+	return &states.Result{Changed: true, Comment: "watched"}, nil
+}
+
+func TestExecuteRequisites(t *testing.T) {
+	p := New()
+	assert.Nil(t, p.ReadFile("testdata/valid/requisites.hcl"))
+	assert.Nil(t, p.Generate())
+	report, err := p.Execute(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, 2, report.Count(StatusFailed))
+
+	var tests = []struct {
+		addr   string
+		status Status
+	}{
+		{"test.run.base", StatusChanged},
+		{"test.run.unchanged", StatusOK},
+		{"test.run.broken", StatusFailed},
+		{"test.run.on_change", StatusOK},
+		{"test.run.no_change", StatusSkipped},
+		{"test.run.on_fail", StatusOK},
+		{"test.run.not_on_fail", StatusSkipped},
+		{"test.run.after_broken", StatusFailed},
+		{"test.run.watcher", StatusChanged},
+		{"test.run.before_base", StatusOK},
+		{"test.run.before_unchanged", StatusSkipped},
+		{"test.run.base_in", StatusOK},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.status, p.results[p.vertex(test.addr)].Status, test.addr)
+	}
+
+	assert.True(t, p.graph.HasEdge(p.vertex("test.run.before_base"), p.vertex("test.run.base")))
+	assert.True(t, p.graph.HasEdge(p.vertex("test.run.base_in"), p.vertex("test.run.unchanged")))
+	assert.Equal(t, []string{kindWatch}, p.graph.EdgeKinds(p.vertex("test.run.base"), p.vertex("test.run.watcher")))
+}
+
+// executionOrder returns the address of every state in the order
+// Execute would run them.
+func executionOrder(t *testing.T, p *Plan) []string {
+	order, err := p.graph.Sort(less)
+	assert.Nil(t, err)
+	var out []string
+	for _, v := range order {
+		if v, ok := v.(*astVertex); ok {
+			out = append(out, v.String())
+		}
+	}
+	return out
+}
+
+func TestExecuteOrder(t *testing.T) {
+	expected := []string{
+		"test.run.first",
+		"test.run.two",
+		"test.run.ten",
+		"test.run.unordered_a",
+		"test.run.unordered_b",
+		"test.run.after_first",
+		"test.run.last",
+	}
+
+	// Map iteration is random, so make sure several plans of the same
+	// config always come out the same.
+	for i := 0; i < 20; i++ {
+		p := New()
+		assert.Nil(t, p.ReadFile("testdata/valid/order.hcl"))
+		assert.Nil(t, p.Generate())
+		assert.Equal(t, expected, executionOrder(t, p))
+	}
+}
+
+func TestExecuteTimeout(t *testing.T) {
+	p := New()
+	assert.Nil(t, p.ReadFile("testdata/valid/timeout.hcl"))
+	assert.Nil(t, p.Generate())
+	report, err := p.Execute(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, StatusFailed, report.Results[0].Status)
+	assert.Equal(t, "timed out after 10ms", report.Results[0].Error)
+	assert.Equal(t, StatusOK, report.Results[1].Status)
+	assert.False(t, report.Cancelled)
+}
+
+func TestExecuteCancel(t *testing.T) {
+	p := New()
+	assert.Nil(t, p.ReadFile("testdata/valid/timeout.hcl"))
+	assert.Nil(t, p.Generate())
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(5*time.Millisecond, cancel)
+
+	// The running state is stopped, and the rest are not started
+	report, err := p.Execute(ctx)
+	assert.Error(t, err)
+	assert.True(t, report.Cancelled)
+	assert.Len(t, report.Results, 2)
+	assert.Equal(t, StatusFailed, report.Results[0].Status)
+	assert.Equal(t, StatusSkipped, report.Results[1].Status)
+	assert.Equal(t, "run cancelled", report.Results[1].Comment)
+}
+
+func TestExecuteRetry(t *testing.T) {
+	p := New()
+	assert.Nil(t, p.ReadFile("testdata/valid/retry.hcl"))
+	assert.Nil(t, p.Generate())
+	p.Execute(context.Background())
+
+	var tests = []struct {
+		addr     string
+		status   Status
+		attempts int
+	}{
+		{"test.run.flaky", StatusOK, 3},
+		{"test.run.gives_up", StatusFailed, 2},
+		{"test.run.permanent", StatusFailed, 1},
+		{"test.run.once", StatusOK, 1},
+	}
+	for _, test := range tests {
+		r := p.results[p.vertex(test.addr)]
+		assert.Equal(t, test.status, r.Status, test.addr)
+		assert.Equal(t, test.attempts, r.Attempts, test.addr)
+	}
+}
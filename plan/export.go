@@ -0,0 +1,119 @@
+package plan
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Cidan/pepper/states"
+)
+
+// ExportFormats are the formats a plan can be exported in
+var ExportFormats = []string{"sh", "cloud-init"}
+
+// exportPath is where the cloud-init format writes the script on the
+// host before running it.
+const exportPath = "/var/lib/pepper/export.sh"
+
+// lineBreaks replaces the line breaks a state name may contain, which
+// would end a comment in the script early.
+var lineBreaks = strings.NewReplacer("\r", " ", "\n", " ")
+
+// Export writes the plan as a POSIX shell script that applies every
+// state without pepper, in the order Execute would, with assertions
+// last. The script stops at the first state that fails. The
+// cloud-init format wraps the script in cloud-config user data.
+//
+// Only state types implementing states.Exporter can be exported.
+// Requisites other than require are refused, since the script cannot
+// tell whether a state changed, while timeouts and retries are not
+// applied.
+func (s *Plan) Export(w io.Writer, format string) error {
+	var script bytes.Buffer
+	if err := s.exportScript(&script); err != nil {
+		return err
+	}
+	switch format {
+	case "sh":
+		_, err := w.Write(script.Bytes())
+		return err
+	case "cloud-init":
+		return cloudInit(w, script.Bytes())
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+// exportScript writes the shell script of the plan
+func (s *Plan) exportScript(w io.Writer) error {
+	order, err := s.graph.Sort(less)
+	if err != nil {
+		return err
+	}
+	var vertices, assertions []*astVertex
+	for _, v := range stateVertices(order) {
+		if v.isAssertion() {
+			assertions = append(assertions, v)
+		} else {
+			vertices = append(vertices, v)
+		}
+	}
+	vertices = append(vertices, assertions...)
+
+	fmt.Fprintf(w, `#!/bin/sh
+# Applies %d states, exported by pepper export.
+set -eu
+
+state=
+trap '[ $? -eq 0 ] || echo "pepper: $state failed" >&2' EXIT
+
+`, len(vertices))
+	for _, v := range vertices {
+		script, err := s.exportVertex(v)
+		if err != nil {
+			return fmt.Errorf("%s: %s", v, err)
+		}
+		fmt.Fprintf(w, "# --- %s\nstate=%s\necho \"==> $state\"\n%s\n",
+			lineBreaks.Replace(v.String()), states.Quote(v.String()), script)
+	}
+	fmt.Fprintf(w, "echo \"pepper: applied %d states\"\n", len(vertices))
+	return nil
+}
+
+// exportVertex returns the script of a single state
+func (s *Plan) exportVertex(v *astVertex) (string, error) {
+	for _, dep := range s.parents(v) {
+		for _, kind := range s.graph.EdgeKinds(dep, v) {
+			if _, watcher := v.states.(states.Watcher); kind == kindRequire || kind == kindWatch && !watcher {
+				continue
+			}
+			return "", fmt.Errorf("%s requisites cannot be exported", kind)
+		}
+	}
+	e, ok := v.states.(states.Exporter)
+	if !ok {
+		return "", fmt.Errorf("%s states cannot be exported", v.addr.Type)
+	}
+	return e.Script()
+}
+
+// cloudInit writes script as cloud-config user data, which writes it
+// to the host and runs it once on first boot.
+func cloudInit(w io.Writer, script []byte) error {
+	fmt.Fprintf(w, `#cloud-config
+write_files:
+  - path: %s
+    permissions: "0755"
+    content: |
+`, exportPath)
+	scanner := bufio.NewScanner(bytes.NewReader(script))
+	for scanner.Scan() {
+		line := strings.TrimRight("      "+scanner.Text(), " ")
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "runcmd:\n  - [%s]\n", exportPath)
+	return err
+}
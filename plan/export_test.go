@@ -0,0 +1,62 @@
+package plan
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExport(t *testing.T) {
+	p := New()
+	assert.Nil(t, p.ReadFile("testdata/valid/export.hcl"))
+	assert.Nil(t, p.Generate())
+
+	for _, format := range ExportFormats {
+		var out bytes.Buffer
+		assert.Nil(t, p.Export(&out, format), format)
+		expected, err := ioutil.ReadFile("testdata/export/export." + format)
+		assert.Nil(t, err)
+		assert.Equal(t, string(expected), out.String(), format)
+	}
+
+	// The script is valid shell
+	cmd := exec.Command("sh", "-n", "testdata/export/export.sh")
+	out, err := cmd.CombinedOutput()
+	assert.Nil(t, err, string(out))
+}
+
+func TestExportHostileName(t *testing.T) {
+	p := New()
+	assert.Nil(t, p.ReadFile("testdata/valid/export_hostile.hcl"))
+	assert.Nil(t, p.Generate())
+	var script bytes.Buffer
+	assert.Nil(t, p.Export(&script, "sh"))
+
+	cmd := exec.Command("sh")
+	cmd.Stdin = &script
+	out, err := cmd.CombinedOutput()
+	assert.Nil(t, err, string(out))
+	assert.Equal(t, "==> shell.run.it's $(echo injected)\n`echo injected`\npepper: applied 1 states\n", string(out))
+}
+
+func TestExportUnsupported(t *testing.T) {
+	var tests = []struct {
+		file string
+		err  string
+	}{
+		{"requisites.hcl", "test.run.first: test states cannot be exported"},
+		{"export_onchanges.hcl", "shell.run.restart: onchanges requisites cannot be exported"},
+	}
+	for _, test := range tests {
+		p := New()
+		assert.Nil(t, p.ReadFile("testdata/valid/"+test.file))
+		assert.Nil(t, p.Generate())
+		err := p.Export(ioutil.Discard, "sh")
+		if assert.Error(t, err, test.file) {
+			assert.Equal(t, test.err, err.Error(), test.file)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package plan
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/Cidan/pepper/address"
+	"github.com/Cidan/pepper/facts"
+	"github.com/Cidan/pepper/graph"
+)
+
+// FileVersion is the version of the saved plan format
+const FileVersion = 1
+
+// File is a saved plan: the resolved graph, the decoded attributes of
+// every state, the changes predicted when it was saved and hashes of
+// the config and facts it was generated from.
+type File struct {
+	Version    int           `json:"version"`
+	Dir        string        `json:"dir,omitempty"`
+	ConfigHash string        `json:"config_hash"`
+	FactsHash  string        `json:"facts_hash"`
+	States     []*savedState `json:"states"`
+	Edges      []*savedEdge  `json:"edges"`
+	Changes    []*Change     `json:"changes"`
+}
+
+type savedState struct {
+	Address    string                 `json:"address"`
+	Attributes map[string]interface{} `json:"attributes"`
+	Tags       []string               `json:"tags,omitempty"`
+	Order      string                 `json:"order,omitempty"`
+	Reboot     bool                   `json:"reboot,omitempty"`
+	Timeout    string                 `json:"timeout,omitempty"`
+	Retry      *retry                 `json:"retry,omitempty"`
+	File       string                 `json:"file"`
+	Line       int                    `json:"line"`
+}
+
+type savedEdge struct {
+	Source string   `json:"source"`
+	Target string   `json:"target"`
+	Kinds  []string `json:"kinds,omitempty"`
+}
+
+// Hash returns a hash of every state file and script read into the
+// plan, and of every state added in code.
+func (s *Plan) Hash() string {
+	h := sha256.New()
+	for _, sources := range [][]*source{s.ast, s.scripts} {
+		for _, src := range sources {
+			fmt.Fprintf(h, "%s\x00%d\x00", src.path, len(src.data))
+			h.Write(src.data)
+		}
+	}
+	for _, a := range s.added {
+		attrs, _ := json.Marshal(a.attrs)
+		fmt.Fprintf(h, "%s\x00%s\x00", a.addr, attrs)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Save writes the generated plan to w, along with the predicted
+// changes and the facts it was generated against. dir is the
+// directory of state files the plan was read from.
+func (s *Plan) Save(w io.Writer, dir string, changes []*Change, f facts.Facts) error {
+	file := &File{
+		Version:    FileVersion,
+		Dir:        dir,
+		ConfigHash: s.Hash(),
+		FactsHash:  f.Hash(),
+		Changes:    changes,
+	}
+
+	for _, v := range s.vertices {
+		file.States = append(file.States, &savedState{
+			Address:    v.String(),
+			Attributes: v.n,
+			Tags:       v.tags,
+			Order:      v.order.String(),
+			Reboot:     v.reboot,
+			Timeout:    timeoutString(v.timeout),
+			Retry:      v.savedRetry(),
+			File:       v.file,
+			Line:       v.line,
+		})
+	}
+
+	for _, v := range append([]graph.Vertex{root}, s.graphVertices()...) {
+		for _, c := range s.graph.Children(v) {
+			file.Edges = append(file.Edges, &savedEdge{
+				Source: fmt.Sprint(v),
+				Target: fmt.Sprint(c),
+				Kinds:  s.graph.EdgeKinds(v, c),
+			})
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(file)
+}
+
+// graphVertices returns every state in declaration order, as graph
+// vertices.
+func (s *Plan) graphVertices() []graph.Vertex {
+	out := make([]graph.Vertex, len(s.vertices))
+	for i, v := range s.vertices {
+		out[i] = v
+	}
+	return out
+}
+
+// Load reads a plan saved with Save. The returned plan executes
+// exactly the saved states and edges, and is not generated again.
+func Load(r io.Reader) (*Plan, *File, error) {
+	var file File
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, nil, fmt.Errorf("invalid plan file: %s", err)
+	}
+	if file.Version != FileVersion {
+		return nil, nil, fmt.Errorf("unsupported plan file version %d", file.Version)
+	}
+
+	s := New()
+	for _, saved := range file.States {
+		addr, err := address.Parse(saved.Address)
+		if err != nil {
+			return nil, nil, err
+		}
+		v := &astVertex{
+			addr:   addr,
+			n:      saved.Attributes,
+			tags:   saved.Tags,
+			file:   saved.File,
+			line:   saved.Line,
+			seq:    len(s.vertices),
+			reboot: saved.Reboot,
+			retry:  noRetry,
+		}
+		if saved.Retry != nil {
+			v.retry = *saved.Retry
+		}
+		if v.n == nil {
+			v.n = map[string]interface{}{}
+		}
+		if saved.Order != "" {
+			v.n["order"] = saved.Order
+		}
+		if saved.Timeout != "" {
+			v.n["timeout"] = saved.Timeout
+		}
+		if err := v.parseOrder(); err != nil {
+			return nil, nil, err
+		}
+		if err := v.parseTimeout(); err != nil {
+			return nil, nil, err
+		}
+		if err := s.getState(v); err != nil {
+			return nil, nil, err
+		}
+		if err := s.graph.AddVertex(v, saved.Address); err != nil {
+			return nil, nil, fmt.Errorf("%s: %s", saved.Address, err)
+		}
+		s.vertices = append(s.vertices, v)
+	}
+
+	for _, e := range file.Edges {
+		var source graph.Vertex = root
+		if e.Source != root.String() {
+			v := s.vertex(e.Source)
+			if v == nil {
+				return nil, nil, fmt.Errorf("invalid plan file: unknown state %s", e.Source)
+			}
+			source = v
+		}
+		target := s.vertex(e.Target)
+		if target == nil {
+			return nil, nil, fmt.Errorf("invalid plan file: unknown state %s", e.Target)
+		}
+		if err := addEdge(s.graph, source, target, e.Kinds); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return s, &file, nil
+}
+
+// Verify returns an error if the config or facts the plan would run
+// against differ from those it was saved with.
+func (f *File) Verify(configHash string, fc facts.Facts) error {
+	if f.ConfigHash != configHash {
+		return fmt.Errorf("state files changed since the plan was saved")
+	}
+	if f.FactsHash != fc.Hash() {
+		return fmt.Errorf("host facts changed since the plan was saved")
+	}
+	return nil
+}
+
+// String returns the order attribute as it would be written
+func (o order) String() string {
+	switch o.class {
+	case orderFirst:
+		return "first"
+	case orderNumbered:
+		return strconv.Itoa(o.n)
+	case orderLast:
+		return "last"
+	}
+	return ""
+}
+
+// timeoutString returns the timeout attribute as it would be written
+func timeoutString(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// savedRetry returns the retry block to save, if the state has one
+func (v *astVertex) savedRetry() *retry {
+	if v.retry.Attempts <= 1 {
+		return nil
+	}
+	r := v.retry
+	return &r
+}
@@ -0,0 +1,71 @@
+package plan
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Cidan/pepper/facts"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveLoad(t *testing.T) {
+	p := New()
+	assert.Nil(t, p.ReadFile("testdata/valid/requisites.hcl"))
+	assert.Nil(t, p.ReadFile("testdata/valid/tags.hcl"))
+	assert.Nil(t, p.Generate())
+	changes, err := p.Check(context.Background())
+	assert.Nil(t, err)
+
+	fc := facts.Facts{"hostname": "test"}
+	var b bytes.Buffer
+	assert.Nil(t, p.Save(&b, "testdata/valid", changes, fc))
+
+	loaded, file, err := Load(&b)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, executionOrder(t, p), executionOrder(t, loaded))
+	assert.Equal(t, changes, file.Changes)
+	assert.Equal(t,
+		p.graph.EdgeKinds(p.vertex("test.run.base"), p.vertex("test.run.watcher")),
+		loaded.graph.EdgeKinds(loaded.vertex("test.run.base"), loaded.vertex("test.run.watcher")))
+
+	assert.Nil(t, file.Verify(p.Hash(), fc))
+	assert.EqualError(t, file.Verify(New().Hash(), fc), "state files changed since the plan was saved")
+	assert.EqualError(t, file.Verify(p.Hash(), facts.Facts{"hostname": "other"}), "host facts changed since the plan was saved")
+}
+
+func TestVerifyScripts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plan")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "greeting.star")
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "web.hcl"), []byte("test run web {\n}\n"), 0644))
+	assert.Nil(t, ioutil.WriteFile(script, []byte("def check(ctx):\n  pass\n"), 0644))
+
+	p := New()
+	assert.Nil(t, p.ReadDir(dir))
+	assert.Nil(t, p.Generate())
+	// Commands save the selected sub-plan, which has the same hash
+	sub, err := p.Select(Selection{Targets: []string{"test.run.web"}})
+	assert.Nil(t, err)
+	fc := facts.Facts{"hostname": "test"}
+	var b bytes.Buffer
+	assert.Nil(t, sub.Save(&b, dir, nil, fc))
+	_, file, err := Load(&b)
+	if !assert.Nil(t, err) {
+		return
+	}
+	unchanged := New()
+	assert.Nil(t, unchanged.ReadDir(dir))
+	assert.Nil(t, file.Verify(unchanged.Hash(), fc))
+
+	assert.Nil(t, ioutil.WriteFile(script, []byte("def check(ctx):\n  fail('changed')\n"), 0644))
+	current := New()
+	assert.Nil(t, current.ReadDir(dir))
+	assert.EqualError(t, file.Verify(current.Hash(), fc), "state files changed since the plan was saved")
+}
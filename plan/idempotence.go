@@ -0,0 +1,56 @@
+package plan
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Cidan/pepper/states"
+	"github.com/rs/zerolog/log"
+)
+
+// CheckIdempotence checks every state that the run applied again,
+// and fails those that would still change. A state that changes on
+// every run, such as a shell command without a guard, is not
+// idempotent. The results in report are updated and published again,
+// and the error of the updated report is returned.
+func (s *Plan) CheckIdempotence(ctx context.Context, report *Report) error {
+	vertices := make(map[*Result]*astVertex, len(s.results))
+	for v, r := range s.results {
+		vertices[r] = v
+	}
+
+	for _, r := range report.Results {
+		v, ok := vertices[r]
+		if !ok || v.isAssertion() || (r.Status != StatusOK && r.Status != StatusChanged) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		res, err := v.check(ctx)
+		if err == nil && !res.Changed {
+			continue
+		}
+		r.Status = StatusFailed
+		r.Error = notIdempotent(res, err)
+		log.Error().Str("state", r.Address).Str("error", r.Error).Msg("State is not idempotent")
+		s.publish(&StateFinished{Time: time.Now(), Result: r})
+	}
+	return report.Err()
+}
+
+// notIdempotent describes why a state failed the second check
+func notIdempotent(res *states.Result, err error) string {
+	if err != nil {
+		return "checking idempotence: " + err.Error()
+	}
+	msg := "not idempotent, would change again"
+	if len(res.Changes) > 0 {
+		msg = "not idempotent, " + strings.Join(res.Changes, ", ") + " would change again"
+	}
+	if res.Comment != "" {
+		msg += ": " + res.Comment
+	}
+	return msg
+}
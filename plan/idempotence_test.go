@@ -0,0 +1,39 @@
+package plan
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckIdempotence(t *testing.T) {
+	p := New()
+	assert.Nil(t, p.ReadFile("testdata/valid/idempotence.hcl"))
+	assert.Nil(t, p.Generate())
+	report, err := p.Execute(context.Background())
+	assert.Nil(t, err)
+
+	var finished []string
+	p.Subscribe(SubscriberFunc(func(e Event) {
+		if f, ok := e.(*StateFinished); ok {
+			finished = append(finished, f.Result.Address)
+		}
+	}))
+	err = p.CheckIdempotence(context.Background(), report)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"test.run.flaps"}, finished)
+
+	statuses := map[string]Status{}
+	errs := map[string]string{}
+	for _, r := range report.Results {
+		statuses[r.Address] = r.Status
+		errs[r.Address] = r.Error
+	}
+	assert.Equal(t, map[string]Status{
+		"test.run.converges": StatusOK,
+		"test.run.flaps":     StatusFailed,
+		"test.run.skipped":   StatusSkipped,
+	}, statuses)
+	assert.Equal(t, "not idempotent, changed would change again", errs["test.run.flaps"])
+}
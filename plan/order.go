@@ -0,0 +1,99 @@
+package plan
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/Cidan/pepper/graph"
+)
+
+// rootVertex is the synthetic root of the plan graph. It is not a
+// state, so no state is treated specially for being declared first.
+type rootVertex struct{}
+
+func (r *rootVertex) String() string {
+	return "root"
+}
+
+var root = &rootVertex{}
+
+// Order classes, in the order they run. As in Salt, states without
+// an order attribute run after numbered states.
+const (
+	orderFirst = iota
+	orderNumbered
+	orderNone
+	orderLast
+)
+
+// order is the parsed order attribute of a state
+type order struct {
+	class int
+	n     int
+}
+
+// parseOrder reads and strips the order attribute, which is either a
+// number, "first" or "last".
+func (v *astVertex) parseOrder() error {
+	v.order = order{class: orderNone}
+	attr, ok := v.n["order"]
+	if !ok {
+		return nil
+	}
+	delete(v.n, "order")
+
+	switch o := attr.(type) {
+	case int:
+		v.order = order{class: orderNumbered, n: o}
+		return nil
+	case string:
+		switch o {
+		case "first":
+			v.order = order{class: orderFirst}
+			return nil
+		case "last":
+			v.order = order{class: orderLast}
+			return nil
+		}
+		if n, err := strconv.Atoi(o); err == nil {
+			v.order = order{class: orderNumbered, n: n}
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: attribute \"order\" must be a number, first or last, got %v", v, attr)
+}
+
+// less orders the vertices that are ready to run at the same time:
+// the root first, then by order attribute, then by declaration.
+func less(a, b graph.Vertex) bool {
+	va, ok := a.(*astVertex)
+	if !ok {
+		return true
+	}
+	vb, ok := b.(*astVertex)
+	if !ok {
+		return false
+	}
+	if va.order.class != vb.order.class {
+		return va.order.class < vb.order.class
+	}
+	if va.order.n != vb.order.n {
+		return va.order.n < vb.order.n
+	}
+	return va.seq < vb.seq
+}
+
+// parents returns the states with an edge to v, in declaration order
+func (s *Plan) parents(v *astVertex) []*astVertex {
+	var out []*astVertex
+	for _, p := range s.graph.Parents(v) {
+		if dep, ok := p.(*astVertex); ok {
+			out = append(out, dep)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].seq < out[j].seq
+	})
+	return out
+}
@@ -8,37 +8,137 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/Cidan/pepper/address"
 	"github.com/Cidan/pepper/graph"
+	"github.com/Cidan/pepper/schema"
 	"github.com/Cidan/pepper/states"
 	"github.com/hashicorp/hcl"
 	"github.com/hashicorp/hcl/hcl/ast"
 	"github.com/mitchellh/mapstructure"
-	"github.com/rs/zerolog/log"
 )
 
 // ShallowWalkFn func def
 type ShallowWalkFn func(string, string, string, ast.Node) error
 
 type astVertex struct {
-	state   string
-	command string
-	name    string
-	n       map[string]interface{}
-	states  states.States
+	addr   address.Address
+	n      map[string]interface{}
+	states states.States
+	tags   []string
+	// file and line the state was declared at, and its position
+	// across every file read, used to break ordering ties.
+	file  string
+	line  int
+	seq   int
+	order order
+	// reboot after this state if it changed
+	reboot bool
+	// timeout of the state, or 0 if it may run for as long as it takes
+	timeout time.Duration
+	retry   retry
 }
 
+func (v *astVertex) String() string {
+	return v.addr.String()
+}
+
+// Meta documents the attributes reserved by the planner. They are
+// accepted on every state and stripped before the state is decoded.
+var Meta = map[string]*schema.Schema{
+	"requires": requisiteSchema("States that must be applied successfully before this one."),
+	"watch": requisiteSchema("Like requires, and if any of these states changed, " +
+		"this state also reacts to the change, e.g. by restarting."),
+	"onchanges":  requisiteSchema("Only apply this state if one of these states changed."),
+	"onfail":     requisiteSchema("Only apply this state if one of these states failed."),
+	"prereq":     requisiteSchema("Apply this state before these states, and only if they are about to change."),
+	"require_in": requisiteSchema("States that require this one, as if they declared requires."),
+	"watch_in":   requisiteSchema("States that watch this one, as if they declared watch."),
+	"tags": {
+		Type:        schema.TypeList,
+		Optional:    true,
+		Elem:        &schema.Schema{Type: schema.TypeString},
+		Description: "Tags to select this state by, with --tags or a tag:name requisite.",
+	},
+	"reboot": {
+		Type:     schema.TypeBool,
+		Optional: true,
+		Default:  false,
+		Description: "Reboot the host after this state if it changed. The run stops, " +
+			"and continues with pepper apply -resume once the host is back.",
+	},
+	"timeout": {
+		Type:     schema.TypeString,
+		Optional: true,
+		Description: "How long the state may run, as a duration such as 30s or 5m. " +
+			"A state that runs longer is stopped and fails.",
+	},
+	"retry": {
+		Type:     schema.TypeMap,
+		Optional: true,
+		Description: "Retries the state if it fails. A block of attempts (required), interval " +
+			"between attempts (default 5s), backoff to multiply the interval by after each " +
+			"attempt (default 1) and until_exit, exit codes that end the retries.",
+	},
+	"order": {
+		Type:     schema.TypeString,
+		Optional: true,
+		Description: "Orders this state against states it has no requisites with: a number, " +
+			"first or last. Numbered states run in ascending order before states without an order.",
+	},
+}
+
+func requisiteSchema(desc string) *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		Elem:     &schema.Schema{Type: schema.TypeString},
+		Description: desc + " Each entry is an address, a wildcard such as apt.* " +
+			"or a tag:name selector, and a single entry may be given as a string.",
+	}
+}
+
+// source is a parsed state file
+type source struct {
+	path string
+	data []byte
+	file *ast.File
+}
+
+// scriptExt is the extension of the scripts kept with the state
+// files, as in script.Ext, which cannot be imported from here.
+const scriptExt = ".star"
+
 // Plan check
 type Plan struct {
 	graph *graph.Digraph
-	ast   []*ast.File
+	ast   []*source
+	// scripts kept with the state files, which define state types
+	scripts []*source
+	// states declared in code with Add
+	added []*added
+	// vertices in the order they were declared
+	vertices []*astVertex
+	results  map[*astVertex]*Result
+	// checkpoint of the run, if it is recorded
+	checkpoint *Checkpoint
+	// events are published to subscribers as the plan runs, and
+	// shared with the plans selected from it
+	events *bus
 }
 
 // New Stuff
 func New() *Plan {
+	g := graph.New()
+	// The first vertex added is the graph root, which every state
+	// without requisites links to.
+	g.AddVertex(root, "root")
 	return &Plan{
-		graph: graph.New(),
+		graph:  g,
+		events: &bus{},
 	}
 }
 
@@ -54,12 +154,14 @@ func (s *Plan) ReadFile(path string) error {
 		return err
 	}
 
-	s.ast = append(s.ast, hclRoot)
+	s.ast = append(s.ast, &source{path, data, hclRoot})
 	return nil
 }
 
 // ReadDir will read an entire directory for HCL files
-// and add it to the AST list
+// and add it to the AST list. Files ending in .hcl or .json are read,
+// so other files such as scripts may be kept alongside. Scripts are
+// read too, only so that the hash of the plan covers them.
 func (s *Plan) ReadDir(dir string) error {
 
 	files, err := ioutil.ReadDir(dir)
@@ -68,7 +170,22 @@ func (s *Plan) ReadDir(dir string) error {
 	}
 
 	for _, file := range files {
-		err := s.ReadFile(dir + "/" + file.Name())
+		if file.IsDir() {
+			continue
+		}
+		path := dir + "/" + file.Name()
+		if filepath.Ext(file.Name()) == scriptExt {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			s.scripts = append(s.scripts, &source{path: path, data: data})
+			continue
+		}
+		if !isStateFile(file.Name()) {
+			continue
+		}
+		err := s.ReadFile(path)
 		if err != nil {
 			return err
 		}
@@ -76,19 +193,34 @@ func (s *Plan) ReadDir(dir string) error {
 	return nil
 }
 
+// isStateFile returns true if name is an HCL or JSON state file
+func isStateFile(name string) bool {
+	return strings.HasSuffix(name, ".hcl") || strings.HasSuffix(name, ".json")
+}
+
 // Generate our full Plan within a DAG and resolve
 // any conflicts
 func (s *Plan) Generate() error {
-	for _, root := range s.ast {
-		err := shallowWalk(*root.Node.(*ast.ObjectList), s.createVertex)
+	for _, src := range s.ast {
+		err := shallowWalk(*src.file.Node.(*ast.ObjectList), func(state, command, name string, n ast.Node) error {
+			return s.createVertex(src.path, state, command, name, n)
+		})
 		if err != nil {
 			return err
 		}
 	}
+	for _, a := range s.added {
+		attrs := make(map[string]interface{}, len(a.attrs))
+		for k, v := range a.attrs {
+			attrs[k] = v
+		}
+		if err := s.addVertex(a.addr, attrs, a.file, a.line); err != nil {
+			return err
+		}
+	}
 
 	// Our graph now has every vertex, let's make the edges
-	for vertex := range s.graph.Vertices() {
-		v := vertex.(*astVertex)
+	for _, v := range s.vertices {
 		err := s.checkReq(v)
 		if err != nil {
 			return err
@@ -98,50 +230,42 @@ func (s *Plan) Generate() error {
 			return err
 		}
 	}
+	if err := s.checkAssertions(); err != nil {
+		return err
+	}
 
-	// TODO:
-	// DAG is now created, let's walk the graph and generate
-	// the execution steps.
-
-	// TODO: move this to a print func
-	/*
-		op, err := s.graph.Print(s.graph.Root(), true)
-		if err != nil {
-			return err
-		}
-		fmt.Printf("Graph output success\n%s", op)
-	*/
+	addrs := make([]string, len(s.vertices))
+	for i, v := range s.vertices {
+		addrs[i] = v.String()
+	}
+	s.publish(&PlanGenerated{Time: time.Now(), States: addrs})
 	return nil
 }
 
-// Execute the plan
-func (s *Plan) Execute() {
-	s.graph.Walk(func(v graph.Vertex) {
-		vv := v.(*astVertex)
-		log.Info().Str("state", vv.name).Msg("Executing state")
-		v.(*astVertex).states.Execute()
-	})
+// Print returns the plan graph as a tree, starting at the root
+func (s *Plan) Print() (string, error) {
+	return s.graph.Print(s.graph.Root(), true)
 }
 
-// getState will generate a state object for this node and
-// update the node.
+// getState will validate the node against the schema of its
+// state type, generate a state object for it and update the node.
 func (s *Plan) getState(v *astVertex) error {
-	switch v.state {
-	case "apt":
-		var o *states.Apt
-		if err := s.decode(v.n, &o); err != nil {
-			return err
-		}
-		v.states = o
-	case "shell":
-		var o *states.Shell
-		if err := s.decode(v.n, &o); err != nil {
-			return err
-		}
-		v.states = o
-	default:
-		return errors.New("Unknown stanza " + v.state)
+	def, ok := states.Lookup(v.addr.Type)
+	if !ok {
+		return fmt.Errorf("%s: unknown state type %q", v, v.addr.Type)
 	}
+	cmd, ok := def.Command(v.addr.Command)
+	if !ok {
+		return fmt.Errorf("%s: unknown command %q for state type %q", v, v.addr.Command, v.addr.Type)
+	}
+	if err := cmd.Validate(v.n); err != nil {
+		return fmt.Errorf("%s: %s", v, err)
+	}
+	o := def.New(v.addr.Command)
+	if err := s.decode(v.n, o); err != nil {
+		return fmt.Errorf("%s: %s", v, err)
+	}
+	v.states = o
 	return nil
 }
 
@@ -159,62 +283,223 @@ func (s *Plan) decode(m map[string]interface{}, raw interface{}) error {
 	return decoder.Decode(m)
 }
 
+// requisite is a relationship between states that can be declared
+// with the attribute attr. Requisites become edges of the given kind
+// from the required state to the declaring state, or the other way
+// around if reverse is set.
+type requisite struct {
+	attr    string
+	kind    string
+	reverse bool
+}
+
+// Kinds of edges in the plan graph
+const (
+	kindRequire   = "require"
+	kindWatch     = "watch"
+	kindOnchanges = "onchanges"
+	kindOnfail    = "onfail"
+	kindPrereq    = "prereq"
+)
+
+var requisites = []requisite{
+	{"requires", kindRequire, false},
+	{"watch", kindWatch, false},
+	{"onchanges", kindOnchanges, false},
+	{"onfail", kindOnfail, false},
+	{"prereq", kindPrereq, true},
+	{"require_in", kindRequire, true},
+	{"watch_in", kindWatch, true},
+}
+
 func (s *Plan) checkReq(v *astVertex) error {
-	switch req := v.n["requires"].(type) {
-	case []string:
-		for _, r := range req {
-			err := s.setEdge(r, v)
-			if err != nil {
+	linked := false
+	for _, r := range requisites {
+		reqs, err := stringList(v.n[r.attr])
+		if err != nil {
+			return fmt.Errorf("%s: attribute %q %s", v, r.attr, err)
+		}
+		for _, req := range reqs {
+			if err := s.setEdge(req, r, v); err != nil {
 				return err
 			}
+			linked = linked || !r.reverse
 		}
-	case string:
-		err := s.setEdge(req, v)
-		if err != nil {
-			return err
-		}
+		// Delete the requisite stanza
+		delete(v.n, r.attr)
+	}
+	if !linked {
+		s.graph.LinkToRoot(v)
+	}
+	return nil
+}
+
+// stringList returns a requisite attribute, which is either a single
+// string or a list of strings, as a list.
+func stringList(attr interface{}) ([]string, error) {
+	switch l := attr.(type) {
 	case nil:
-		err := s.setEdge("", v)
-		if err != nil {
-			return err
+		return nil, nil
+	case string:
+		return []string{l}, nil
+	case []string:
+		return l, nil
+	case []interface{}:
+		out := make([]string, len(l))
+		for i, e := range l {
+			str, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("element %d must be a string, got %T", i, e)
+			}
+			out[i] = str
 		}
+		return out, nil
 	}
-	// Delete the requires stanza
-	delete(v.n, "requires")
-	return nil
+	return nil, fmt.Errorf("must be a string or a list of strings, got %T", attr)
 }
 
-func (s *Plan) setEdge(req string, v *astVertex) error {
+func (s *Plan) setEdge(req string, r requisite, v *astVertex) error {
+	sel, err := address.ParseSelector(req)
+	if err != nil {
+		return fmt.Errorf("%s: invalid '%s' %q: %s", v, r.attr, req, err)
+	}
 
-	if req != "" {
-		suuid := strings.Replace(req, ".", "", -1)
-		tuuid := v.state + v.command + v.name
-		err := s.graph.LinkViaUUID(suuid, tuuid)
-		if err == graph.ErrSourceVertexNotExists {
-			return fmt.Errorf("unable to find 'requires' state '%s', which %s.%s.%s depends on",
-				req, v.state, v.command, v.name)
+	// Wildcards never match the state that declares them, but naming
+	// it is a cycle
+	if !sel.IsWildcard() && sel.Match(v.addr, v.tags) {
+		return fmt.Errorf("%s: unable to %s %s: %s", v, r.attr, v, graph.ErrCycle)
+	}
+	matched := 0
+	for _, dep := range s.vertices {
+		if dep == v || !sel.Match(dep.addr, dep.tags) {
+			continue
 		}
-		if err == graph.ErrTargetVertexNotExists {
-			return fmt.Errorf("unable to find target state %s.%s.%s which '%s' points to",
-				v.state, v.command, v.name, req)
+		matched++
+		source, target := dep, v
+		if r.reverse {
+			source, target = v, dep
 		}
-		if err != nil {
-			return err
+		if err := s.graph.AddEdgeKind(source, target, r.kind); err != nil {
+			return fmt.Errorf("%s: unable to %s %s: %s", v, r.attr, dep, err)
 		}
-	} else {
-		s.graph.LinkToRoot(v)
 	}
+
+	if matched == 0 {
+		return fmt.Errorf("unable to find '%s' state '%s', which %s depends on", r.attr, req, v)
+	}
+	return nil
+}
+
+// parseTags reads and strips the tags attribute
+func (v *astVertex) parseTags() error {
+	tags, err := stringList(v.n["tags"])
+	if err != nil {
+		return fmt.Errorf("%s: attribute \"tags\" %s", v, err)
+	}
+	delete(v.n, "tags")
+	for _, t := range tags {
+		if !address.ValidTag(t) {
+			return fmt.Errorf("%s: invalid tag %q", v, t)
+		}
+	}
+	v.tags = tags
+	return nil
+}
+
+// parseReboot reads and strips the reboot attribute
+func (v *astVertex) parseReboot() error {
+	attr, ok := v.n["reboot"]
+	if !ok {
+		return nil
+	}
+	delete(v.n, "reboot")
+	reboot, ok := attr.(bool)
+	if !ok {
+		return fmt.Errorf("%s: attribute \"reboot\" must be a bool, got %v", v, attr)
+	}
+	v.reboot = reboot
+	return nil
+}
+
+// parseTimeout reads and strips the timeout attribute
+func (v *astVertex) parseTimeout() error {
+	attr, ok := v.n["timeout"]
+	if !ok {
+		return nil
+	}
+	delete(v.n, "timeout")
+	str, ok := attr.(string)
+	d, err := time.ParseDuration(str)
+	if !ok || err != nil || d <= 0 {
+		return fmt.Errorf("%s: attribute \"timeout\" must be a positive duration such as 30s, got %v", v, attr)
+	}
+	v.timeout = d
 	return nil
 }
 
-func (s *Plan) createVertex(state, command, name string, n ast.Node) error {
+// SetCheckpoint records the progress of Execute in c, and skips any
+// state c says was completed before.
+func (s *Plan) SetCheckpoint(c *Checkpoint) {
+	s.checkpoint = c
+}
+
+// vertex returns the vertex declared at addr, or nil
+func (s *Plan) vertex(addr string) *astVertex {
+	for _, v := range s.vertices {
+		if v.addr.String() == addr {
+			return v
+		}
+	}
+	return nil
+}
+
+func (s *Plan) createVertex(path, state, command, name string, n ast.Node) error {
+	addr := address.New(state, command, name)
+	if err := addr.Validate(); err != nil {
+		return fmt.Errorf("%s: %s", addr, err)
+	}
+
 	m := make(map[string]interface{})
 	err := hcl.DecodeObject(&m, n)
 	if err != nil {
 		return err
 	}
-	v := &astVertex{state, command, name, m, nil}
-	return s.graph.AddVertex(v, state+command+name)
+	return s.addVertex(addr, m, path, n.Pos().Line)
+}
+
+// addVertex adds the state declared at file and line with the
+// attributes m, reading the reserved attributes that apply to it.
+func (s *Plan) addVertex(addr address.Address, m map[string]interface{}, file string, line int) error {
+	v := &astVertex{
+		addr: addr,
+		n:    m,
+		file: file,
+		line: line,
+		seq:  len(s.vertices),
+	}
+	if err := v.parseOrder(); err != nil {
+		return err
+	}
+	if err := v.parseTags(); err != nil {
+		return err
+	}
+	if err := v.parseReboot(); err != nil {
+		return err
+	}
+	if err := v.parseTimeout(); err != nil {
+		return err
+	}
+	if err := v.parseRetry(); err != nil {
+		return err
+	}
+	if err := s.graph.AddVertex(v, addr.String()); err != nil {
+		if err == graph.ErrVertexExists {
+			return fmt.Errorf("%s: declared more than once", addr)
+		}
+		return err
+	}
+	s.vertices = append(s.vertices, v)
+	return nil
 }
 
 // ShallowWalk will walk only the top level of the tree and call
@@ -224,10 +509,19 @@ func shallowWalk(n ast.ObjectList, fn ShallowWalkFn) error {
 		if len(item.Keys) < 3 {
 			return errors.New("Invalid state")
 		}
-		err := fn(item.Keys[0].Token.Text, item.Keys[1].Token.Text, item.Keys[2].Token.Text, item.Val)
+		err := fn(keyText(item.Keys[0]), keyText(item.Keys[1]), keyText(item.Keys[2]), item.Val)
 		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// keyText returns the unquoted text of a key, so that quoted keys and
+// keys from JSON files name the same state as bare HCL identifiers.
+func keyText(k *ast.ObjectKey) string {
+	if v, ok := k.Token.Value().(string); ok {
+		return v
+	}
+	return k.Token.Text
+}
@@ -1,7 +1,10 @@
 package plan
 
-import "testing"
-import "github.com/stretchr/testify/assert"
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
 
 func TestNew(t *testing.T) {
 	p := New()
@@ -13,3 +16,59 @@ func TestGenerate(t *testing.T) {
 	assert.Nil(t, p.ReadDir("../examples/"))
 	assert.Nil(t, p.Generate())
 }
+
+func TestGenerateInvalid(t *testing.T) {
+	var tests = []struct {
+		file string
+		err  string
+	}{
+		{"list_for_string.hcl", `shell.run.list_for_string: attribute "cmd" must be a string, got list`},
+		{"unknown_command.hcl", `apt.remove.base_system: unknown command "remove" for state type "apt"`},
+		{"missing_required.hcl", `apt.install.missing_packages: missing required attribute "packages"`},
+		{"unknown_attribute.hcl", `shell.run.unknown_attribute: unknown attribute "comand"`},
+		{"bad_order.hcl", `shell.run.bad_order: attribute "order" must be a number, first or last, got soon`},
+		{"bad_timeout.hcl", `shell.run.bad_timeout: attribute "timeout" must be a positive duration such as 30s, got soon`},
+		{"bad_retry.hcl", `shell.run.bad_retry: retry: attempts must be a positive number, got 0`},
+		{"bad_tag.hcl", `shell.run.bad_tag: invalid tag "web server"`},
+		{"assert_required.hcl", `shell.run.after_check: assertions run last and cannot be required: assert.file_exists.ready`},
+		{"assert_require_in.hcl", `shell.run.restart: assertions run last and cannot be required: assert.command.healthy`},
+		{"self_requires.hcl", `shell.run.loop: unable to requires shell.run.loop: digraph: cycle between edges`},
+		{"missing_requires.hcl", `unable to find 'requires' state 'apt.install.nothing', which shell.run.configure depends on`},
+	}
+
+	for _, test := range tests {
+		p := New()
+		assert.Nil(t, p.ReadFile("testdata/invalid/"+test.file))
+		err := p.Generate()
+		if assert.Error(t, err, test.file) {
+			assert.Equal(t, test.err, err.Error(), test.file)
+		}
+	}
+}
+
+func TestGenerateDefaults(t *testing.T) {
+	p := New()
+	assert.Nil(t, p.ReadFile("testdata/valid/defaults.hcl"))
+	assert.Nil(t, p.Generate())
+	for _, v := range p.vertices {
+		assert.Equal(t, false, v.n["allow_no_version"])
+	}
+}
+
+func TestGenerateStateExamples(t *testing.T) {
+	p := New()
+	assert.Nil(t, p.ReadDir("../states/testdata/"))
+	assert.Nil(t, p.Generate())
+}
+
+func TestGenerateWildcardRequires(t *testing.T) {
+	p := New()
+	assert.Nil(t, p.ReadFile("testdata/valid/wildcard.hcl"))
+	assert.Nil(t, p.Generate())
+
+	configure := p.vertex("shell.run.configure")
+	assert.NotNil(t, configure)
+	for _, dep := range []string{"apt.install.web.frontend", "apt.install.web.backend"} {
+		assert.True(t, p.graph.HasEdge(p.vertex(dep), configure), dep)
+	}
+}
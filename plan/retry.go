@@ -0,0 +1,174 @@
+package plan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Cidan/pepper/states"
+	"github.com/rs/zerolog/log"
+)
+
+// Defaults of the retry block
+const (
+	defaultRetryInterval = 5 * time.Second
+	defaultRetryBackoff  = 1.0
+)
+
+// retry is the parsed retry block of a state
+type retry struct {
+	Attempts int           `json:"attempts"`
+	Interval time.Duration `json:"interval"`
+	Backoff  float64       `json:"backoff"`
+	// UntilExit are the exit codes that end the retries. If empty,
+	// every failure is retried.
+	UntilExit []int `json:"until_exit,omitempty"`
+}
+
+// noRetry runs a state once
+var noRetry = retry{Attempts: 1}
+
+// parseRetry reads and strips the retry block, which looks like
+//
+//	retry {
+//	  attempts   = 3
+//	  interval   = "10s"
+//	  backoff    = 2.0
+//	  until_exit = [0]
+//	}
+func (v *astVertex) parseRetry() error {
+	v.retry = noRetry
+	attr, ok := v.n["retry"]
+	if !ok {
+		return nil
+	}
+	delete(v.n, "retry")
+
+	m, ok := attr.(map[string]interface{})
+	if l, isList := attr.([]map[string]interface{}); isList && len(l) == 1 {
+		m, ok = l[0], true
+	}
+	if !ok {
+		return fmt.Errorf("%s: attribute \"retry\" must be a block, got %v", v, attr)
+	}
+	r, err := newRetry(m)
+	if err != nil {
+		return fmt.Errorf("%s: retry: %s", v, err)
+	}
+	v.retry = r
+	return nil
+}
+
+func newRetry(m map[string]interface{}) (retry, error) {
+	r := retry{Interval: defaultRetryInterval, Backoff: defaultRetryBackoff}
+	for k, attr := range m {
+		switch k {
+		case "attempts":
+			n, ok := integer(attr)
+			if !ok || n < 1 {
+				return r, fmt.Errorf("attempts must be a positive number, got %v", attr)
+			}
+			r.Attempts = n
+		case "interval":
+			str, ok := attr.(string)
+			d, err := time.ParseDuration(str)
+			if !ok || err != nil || d < 0 {
+				return r, fmt.Errorf("interval must be a duration such as 10s, got %v", attr)
+			}
+			r.Interval = d
+		case "backoff":
+			f, ok := attr.(float64)
+			if n, isInt := integer(attr); isInt {
+				f, ok = float64(n), true
+			}
+			if !ok || f < 1 {
+				return r, fmt.Errorf("backoff must be a number of at least 1, got %v", attr)
+			}
+			r.Backoff = f
+		case "until_exit":
+			l, ok := attr.([]interface{})
+			if !ok {
+				return r, fmt.Errorf("until_exit must be a list of exit codes, got %v", attr)
+			}
+			for _, e := range l {
+				code, ok := integer(e)
+				if !ok {
+					return r, fmt.Errorf("until_exit must be a list of exit codes, got %v", attr)
+				}
+				r.UntilExit = append(r.UntilExit, code)
+			}
+		default:
+			return r, fmt.Errorf("unknown attribute %q", k)
+		}
+	}
+	if r.Attempts == 0 {
+		return r, errors.New("missing required attribute \"attempts\"")
+	}
+	return r, nil
+}
+
+// integer returns attr as an int, if it is a whole number
+func integer(attr interface{}) (int, bool) {
+	switch n := attr.(type) {
+	case int:
+		return n, true
+	case float64:
+		if n == float64(int(n)) {
+			return int(n), true
+		}
+	}
+	return 0, false
+}
+
+// exitCoder is implemented by the errors of commands that ran and
+// exited non-zero, such as *exec.ExitError.
+type exitCoder interface {
+	ExitCode() int
+}
+
+// retryable returns true if a failed attempt should be retried
+func (r retry) retryable(err error) bool {
+	if len(r.UntilExit) == 0 {
+		return true
+	}
+	var e exitCoder
+	if !errors.As(err, &e) {
+		return true
+	}
+	for _, code := range r.UntilExit {
+		if e.ExitCode() == code {
+			return false
+		}
+	}
+	return true
+}
+
+// execute runs the state, retrying it as its retry block allows, and
+// returns the result of the last attempt and the number of attempts.
+// The timeout of the state applies to each attempt.
+func (v *astVertex) execute(ctx context.Context) (*states.Result, int, error) {
+	interval := v.retry.Interval
+	for attempt := 1; ; attempt++ {
+		actx, cancel := v.withTimeout(ctx)
+		res, err := v.states.Execute(actx)
+		err = v.timedOut(actx, err)
+		cancel()
+		if err == nil || attempt >= v.retry.Attempts || !v.retry.retryable(err) {
+			return res, attempt, err
+		}
+
+		log.Warn().Str("state", v.String()).
+			Int("attempt", attempt).
+			Int("attempts", v.retry.Attempts).
+			Str("error", err.Error()).
+			Dur("retry_in", interval).
+			Msg("State failed, retrying")
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil, attempt, err
+		}
+		interval = time.Duration(float64(interval) * v.retry.Backoff)
+	}
+}
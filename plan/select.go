@@ -0,0 +1,187 @@
+package plan
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Cidan/pepper/address"
+	"github.com/Cidan/pepper/graph"
+)
+
+// Selection restricts a plan to a subset of its states. Targets and
+// Exclude are selectors, e.g. apt.install.base_system, shell.run.* or
+// tag:web.
+type Selection struct {
+	// Targets to apply. No targets selects every state.
+	Targets []string
+	// Exclude states, even if a target requires them
+	Exclude []string
+	// Dependents also selects every state that depends on a target
+	Dependents bool
+	// Tags to select, where a tag prefixed with ! excludes states
+	// with that tag instead, e.g. db,!slow selects every state tagged
+	// db that is not also tagged slow.
+	Tags []string
+}
+
+// selectors converts tag expressions into target and exclude
+// selectors.
+func (sel Selection) selectors() (targets, exclude []string, err error) {
+	targets = append(targets, sel.Targets...)
+	exclude = append(exclude, sel.Exclude...)
+	for _, t := range sel.Tags {
+		negate := strings.HasPrefix(t, "!")
+		t = strings.TrimPrefix(t, "!")
+		if !address.ValidTag(t) {
+			return nil, nil, fmt.Errorf("invalid tag %q", t)
+		}
+		if negate {
+			exclude = append(exclude, "tag:"+t)
+		} else {
+			targets = append(targets, "tag:"+t)
+		}
+	}
+	return targets, exclude, nil
+}
+
+// Select returns a sub-plan with the states matched by the selection
+// and everything they require, with requisites between them intact.
+// The plan must have been generated.
+func (s *Plan) Select(sel Selection) (*Plan, error) {
+	targetSelectors, excludeSelectors, err := sel.selectors()
+	if err != nil {
+		return nil, err
+	}
+	targets, err := s.match(targetSelectors)
+	if err != nil {
+		return nil, err
+	}
+	if len(targetSelectors) == 0 {
+		targets = s.vertices
+	}
+	excluded, err := s.match(excludeSelectors)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := map[*astVertex]bool{}
+	var include func(v *astVertex)
+	include = func(v *astVertex) {
+		if selected[v] {
+			return
+		}
+		selected[v] = true
+		for _, a := range s.graph.Ancestors(v) {
+			if dep, ok := a.(*astVertex); ok {
+				selected[dep] = true
+			}
+		}
+	}
+	for _, v := range targets {
+		include(v)
+		if !sel.Dependents {
+			continue
+		}
+		// Dependents need everything they require as well
+		for _, d := range s.graph.Descendants(v) {
+			if dep, ok := d.(*astVertex); ok {
+				include(dep)
+			}
+		}
+	}
+	for _, v := range excluded {
+		delete(selected, v)
+	}
+
+	return s.subPlan(selected)
+}
+
+// match returns every state matched by any of the selectors, in
+// declaration order. A selector that matches nothing is an error.
+func (s *Plan) match(selectors []string) ([]*astVertex, error) {
+	matched := map[*astVertex]bool{}
+	for _, str := range selectors {
+		sel, err := address.ParseSelector(str)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, v := range s.vertices {
+			if sel.Match(v.addr, v.tags) {
+				matched[v] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%q matches no states", str)
+		}
+	}
+
+	var out []*astVertex
+	for v := range matched {
+		out = append(out, v)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].seq < out[j].seq
+	})
+	return out, nil
+}
+
+// subPlan builds a plan of the selected states. States that lost all
+// of their parents are linked to the root. It keeps the checkpoint and
+// the subscribers of s, so that Select may come before or after them.
+func (s *Plan) subPlan(selected map[*astVertex]bool) (*Plan, error) {
+	p := New()
+	p.ast = s.ast
+	p.scripts = s.scripts
+	p.added = s.added
+	p.checkpoint = s.checkpoint
+	p.events = s.events
+	for _, v := range s.vertices {
+		if !selected[v] {
+			continue
+		}
+		if err := p.graph.AddVertex(v, v.addr.String()); err != nil {
+			return nil, err
+		}
+		p.vertices = append(p.vertices, v)
+	}
+
+	for _, v := range p.vertices {
+		linked := false
+		for _, dep := range s.parents(v) {
+			if !selected[dep] {
+				continue
+			}
+			linked = true
+			if err := copyEdge(s.graph, p.graph, dep, v); err != nil {
+				return nil, err
+			}
+		}
+		if !linked {
+			p.graph.LinkToRoot(v)
+		}
+	}
+	return p, nil
+}
+
+// copyEdge adds the edge between source and target in from to to,
+// with all of its kinds.
+func copyEdge(from, to *graph.Digraph, source, target graph.Vertex) error {
+	return addEdge(to, source, target, from.EdgeKinds(source, target))
+}
+
+// addEdge adds an edge labelled with every kind, or a plain edge if
+// there are none.
+func addEdge(g *graph.Digraph, source, target graph.Vertex, kinds []string) error {
+	if len(kinds) == 0 {
+		return g.AddEdge(source, target)
+	}
+	for _, k := range kinds {
+		if err := g.AddEdgeKind(source, target, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
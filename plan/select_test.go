@@ -0,0 +1,89 @@
+package plan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelect(t *testing.T) {
+	p := New()
+	assert.Nil(t, p.ReadFile("testdata/valid/select.hcl"))
+	assert.Nil(t, p.Generate())
+
+	var tests = []struct {
+		sel      Selection
+		expected []string
+	}{
+		{Selection{}, []string{"test.run.a", "test.run.b", "test.run.c", "test.run.d", "test.run.e"}},
+		{Selection{Targets: []string{"test.run.c"}}, []string{"test.run.a", "test.run.b", "test.run.c"}},
+		{Selection{Targets: []string{"test.run.b"}, Dependents: true}, []string{"test.run.a", "test.run.b", "test.run.c", "test.run.e"}},
+		{Selection{Targets: []string{"test.run.c"}, Exclude: []string{"test.run.a"}}, []string{"test.run.b", "test.run.c"}},
+		{Selection{Targets: []string{"test.run.d", "test.run.a"}}, []string{"test.run.a", "test.run.d"}},
+	}
+
+	for _, test := range tests {
+		sub, err := p.Select(test.sel)
+		if assert.Nil(t, err) {
+			assert.Equal(t, test.expected, executionOrder(t, sub), "%+v", test.sel)
+		}
+	}
+
+	sub, err := p.Select(Selection{Targets: []string{"test.run.c"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{kindOnchanges}, sub.graph.EdgeKinds(sub.vertex("test.run.b"), sub.vertex("test.run.c")))
+
+	_, err = p.Select(Selection{Targets: []string{"apt.*"}})
+	assert.EqualError(t, err, `"apt.*" matches no states`)
+}
+
+func TestSelectKeepsRun(t *testing.T) {
+	p := New()
+	assert.Nil(t, p.ReadFile("testdata/valid/select.hcl"))
+	assert.Nil(t, p.Generate())
+	var started []string
+	p.Subscribe(SubscriberFunc(func(e Event) {
+		if e, ok := e.(*StateStarted); ok {
+			started = append(started, e.Address)
+		}
+	}))
+	c := NewCheckpoint(filepath.Join(os.TempDir(), "pepper-select-checkpoint.json"), p.Hash())
+	defer c.Remove()
+	c.Results["test.run.a"] = &Result{Address: "test.run.a", Status: StatusChanged}
+	p.SetCheckpoint(c)
+
+	// The subscribers and checkpoint set before Select carry over
+	sub, err := p.Select(Selection{Targets: []string{"test.run.b"}})
+	assert.Nil(t, err)
+	report, err := sub.Execute(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "completed before resuming", report.Results[0].Comment)
+	assert.Equal(t, []string{"test.run.b"}, started)
+}
+
+func TestSelectTags(t *testing.T) {
+	p := New()
+	assert.Nil(t, p.ReadFile("testdata/valid/tags.hcl"))
+	assert.Nil(t, p.Generate())
+	assert.True(t, p.graph.HasEdge(p.vertex("test.run.db"), p.vertex("test.run.after_baseline")))
+
+	var tests = []struct {
+		tags     []string
+		expected []string
+	}{
+		{[]string{"db"}, []string{"test.run.db", "test.run.slow_db"}},
+		{[]string{"db", "!slow"}, []string{"test.run.db"}},
+		{[]string{"!slow"}, []string{"test.run.db", "test.run.web", "test.run.after_baseline"}},
+		{[]string{"web", "baseline"}, []string{"test.run.db", "test.run.web"}},
+	}
+
+	for _, test := range tests {
+		sub, err := p.Select(Selection{Tags: test.tags})
+		if assert.Nil(t, err) {
+			assert.Equal(t, test.expected, executionOrder(t, sub), "%v", test.tags)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+#!/bin/sh
+# Applies 4 states, exported by pepper export.
+set -eu
+
+state=
+trap '[ $? -eq 0 ] || echo "pepper: $state failed" >&2' EXIT
+
+# --- apt.install.web
+state=apt.install.web
+echo "==> $state"
+missing=
+for p in nginx curl=7.88.1-10; do
+  dpkg-query -W -f='${Status}' "${p%%=*}" 2>/dev/null | grep -q ' installed$' || missing="$missing $p"
+done
+if [ -n "$missing" ]; then
+  apt-get -o DPkg::Lock::Timeout=600 update
+  apt-get -o DPkg::Lock::Timeout=600 -q -y --force-yes -o DPkg::Options::=--force-confdef -o DPkg::Options::=--force-confold install $missing
+fi
+
+# --- shell.run.configure
+state=shell.run.configure
+echo "==> $state"
+sh -c 'echo '\''daemon off;'\'' >> /etc/nginx/nginx.conf'
+
+# --- assert.command.nginx_config
+state=assert.command.nginx_config
+echo "==> $state"
+rc=0
+nginx -t || rc=$?
+if [ $rc -ne 0 ]; then
+  echo "exited $rc, expected 0" >&2
+  exit 1
+fi
+
+# --- assert.file_contains.daemon
+state=assert.file_contains.daemon
+echo "==> $state"
+grep -qF -- 'daemon off;' /etc/nginx/nginx.conf || { echo 'assertion failed' >&2; exit 1; }
+
+echo "pepper: applied 4 states"
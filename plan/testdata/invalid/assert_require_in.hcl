@@ -0,0 +1,8 @@
+assert command healthy {
+  cmd      = "true"
+  watch_in = "shell.run.restart"
+}
+
+shell run restart {
+  cmd = "true"
+}
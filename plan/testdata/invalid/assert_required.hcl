@@ -0,0 +1,8 @@
+assert file_exists ready {
+  path = "/etc/ready"
+}
+
+shell run after_check {
+  cmd      = "true"
+  requires = "assert.file_exists.ready"
+}
@@ -0,0 +1,4 @@
+shell run bad_order {
+  cmd   = "true"
+  order = "soon"
+}
@@ -0,0 +1,7 @@
+shell run bad_retry {
+  cmd = "true"
+
+  retry {
+    attempts = 0
+  }
+}
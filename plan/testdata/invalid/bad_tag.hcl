@@ -0,0 +1,4 @@
+shell run bad_tag {
+  cmd  = "true"
+  tags = ["web server"]
+}
@@ -0,0 +1,4 @@
+shell run bad_timeout {
+  cmd     = "true"
+  timeout = "soon"
+}
@@ -0,0 +1,3 @@
+shell run list_for_string {
+  cmd = ["apt", "install"]
+}
@@ -0,0 +1,3 @@
+apt install missing_packages {
+  allow_no_version = true
+}
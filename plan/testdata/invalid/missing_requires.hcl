@@ -0,0 +1,4 @@
+shell run configure {
+  cmd      = "true"
+  requires = "apt.install.nothing"
+}
@@ -0,0 +1,4 @@
+shell run loop {
+  cmd      = "true"
+  requires = "shell.run.loop"
+}
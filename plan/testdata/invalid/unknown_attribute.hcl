@@ -0,0 +1,4 @@
+shell run unknown_attribute {
+  cmd     = "true"
+  comand  = "typo"
+}
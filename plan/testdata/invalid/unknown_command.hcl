@@ -0,0 +1,3 @@
+apt remove base_system {
+  packages = ["htop"]
+}
@@ -0,0 +1,13 @@
+test run setup {
+  echo = "hello"
+}
+
+assert file_exists fixtures {
+  path = "/valid"
+  type = "directory"
+}
+
+assert file_contains missing {
+  path = "/valid/events.hcl"
+  text = "not in the file"
+}
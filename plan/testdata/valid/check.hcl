@@ -0,0 +1,8 @@
+test run broken {
+  check_fail = true
+  tags       = "db"
+}
+
+test run after {
+  changed = true
+}
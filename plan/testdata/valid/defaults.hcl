@@ -0,0 +1,3 @@
+apt install defaults {
+  packages = ["htop"]
+}
@@ -0,0 +1,7 @@
+test run first {
+  echo = "hello"
+}
+
+test run second {
+  requires = "test.run.first"
+}
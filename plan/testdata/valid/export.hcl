@@ -0,0 +1,20 @@
+apt install web {
+  allow_no_version = true
+  packages = ["nginx", "curl=7.88.1-10"]
+}
+
+shell run configure {
+  cmd      = "sh"
+  args     = ["-c", "echo 'daemon off;' >> /etc/nginx/nginx.conf"]
+  requires = "apt.install.web"
+}
+
+assert command nginx_config {
+  cmd  = "nginx"
+  args = ["-t"]
+}
+
+assert file_contains daemon {
+  path = "/etc/nginx/nginx.conf"
+  text = "daemon off;"
+}
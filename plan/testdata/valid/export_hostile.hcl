@@ -0,0 +1,3 @@
+shell run "it's $(echo injected)\n`echo injected`" {
+  cmd = "true"
+}
@@ -0,0 +1,8 @@
+shell run update {
+  cmd = "true"
+}
+
+shell run restart {
+  cmd       = "true"
+  onchanges = "shell.run.update"
+}
@@ -0,0 +1,11 @@
+test run converges {
+}
+
+test run flaps {
+  changed = true
+}
+
+test run skipped {
+  onchanges = "test.run.converges"
+  changed   = true
+}
@@ -0,0 +1,23 @@
+test run unordered_a {}
+
+test run last {
+  order = "last"
+}
+
+test run ten {
+  order = 10
+}
+
+test run unordered_b {}
+
+test run first {
+  order = "first"
+}
+
+test run two {
+  order = 2
+}
+
+test run after_first {
+  requires = "test.run.first"
+}
@@ -0,0 +1,12 @@
+test run before {
+  changed = true
+}
+
+test run kernel {
+  changed = true
+  reboot  = true
+}
+
+test run after {
+  requires = "test.run.kernel"
+}
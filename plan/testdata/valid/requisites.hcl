@@ -0,0 +1,47 @@
+test run first {}
+
+test run base {
+  changed = true
+}
+
+test run unchanged {}
+
+test run broken {
+  fail = true
+}
+
+test run on_change {
+  onchanges = "test.run.base"
+}
+
+test run no_change {
+  onchanges = "test.run.unchanged"
+}
+
+test run on_fail {
+  onfail = ["test.run.broken"]
+}
+
+test run not_on_fail {
+  onfail = ["test.run.base"]
+}
+
+test run after_broken {
+  requires = ["test.run.broken"]
+}
+
+test run watcher {
+  watch = "test.run.base"
+}
+
+test run before_base {
+  prereq = "test.run.base"
+}
+
+test run before_unchanged {
+  prereq = "test.run.unchanged"
+}
+
+test run base_in {
+  require_in = "test.run.unchanged"
+}
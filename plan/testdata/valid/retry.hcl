@@ -0,0 +1,31 @@
+test run flaky {
+  flaky = 2
+
+  retry {
+    attempts = 3
+    interval = "1ms"
+  }
+}
+
+test run gives_up {
+  flaky = 5
+
+  retry {
+    attempts = 2
+    interval = "1ms"
+    backoff  = 2.0
+  }
+}
+
+test run permanent {
+  flaky = 5
+  exit  = 2
+
+  retry {
+    attempts   = 3
+    interval   = "1ms"
+    until_exit = [0, 2]
+  }
+}
+
+test run once {}
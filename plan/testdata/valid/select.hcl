@@ -0,0 +1,15 @@
+test run a {}
+
+test run b {
+  requires = "test.run.a"
+}
+
+test run c {
+  onchanges = "test.run.b"
+}
+
+test run d {}
+
+test run e {
+  requires = "test.run.c"
+}
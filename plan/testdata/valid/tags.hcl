@@ -0,0 +1,15 @@
+test run db {
+  tags = ["db", "baseline"]
+}
+
+test run slow_db {
+  tags = ["db", "slow"]
+}
+
+test run web {
+  tags = "web"
+}
+
+test run after_baseline {
+  requires = "tag:baseline"
+}
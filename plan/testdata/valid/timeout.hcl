@@ -0,0 +1,8 @@
+test run slow {
+  sleep   = "1s"
+  timeout = "10ms"
+}
+
+test run after {
+  order = "last"
+}
@@ -0,0 +1,12 @@
+apt install "web.frontend" {
+  packages = ["nginx"]
+}
+
+apt install web.backend {
+  packages = ["uwsgi"]
+}
+
+shell run configure {
+  cmd      = "true"
+  requires = "apt.*"
+}
@@ -0,0 +1,73 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Cidan/pepper/graph"
+)
+
+// assertType is the state type of assertions, which check the system
+// is as expected without changing it.
+const assertType = "assert"
+
+// isAssertion returns true if v is an assertion
+func (v *astVertex) isAssertion() bool {
+	return v.addr.Type == assertType
+}
+
+// checkAssertions returns an error if an assertion is a requisite of
+// any other state, since assertions only run once every other state
+// has.
+func (s *Plan) checkAssertions() error {
+	for _, v := range s.vertices {
+		if v.isAssertion() {
+			continue
+		}
+		for _, dep := range s.parents(v) {
+			if dep.isAssertion() {
+				return fmt.Errorf("%s: assertions run last and cannot be required: %s", v, dep)
+			}
+		}
+	}
+	return nil
+}
+
+// Verify runs every assertion of the plan without applying any other
+// state, and reports whether each passed. Requisites of assertions
+// are ignored, since the states they name are not applied.
+func (s *Plan) Verify(ctx context.Context) (*Report, error) {
+	order, err := s.graph.Sort(less)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Started: time.Now()}
+	s.results = map[*astVertex]*Result{}
+	s.runAssertions(ctx, order, report, s.assert)
+	report.Duration = time.Since(report.Started)
+	s.publish(&RunFinished{Time: time.Now(), Report: report})
+	return report, report.Err()
+}
+
+// runAssertions runs every assertion in order with fn
+func (s *Plan) runAssertions(ctx context.Context, order []graph.Vertex, report *Report, fn func(context.Context, *astVertex) *Result) {
+	for _, v := range stateVertices(order) {
+		if !v.isAssertion() || s.cancelled(ctx, v, report) {
+			continue
+		}
+		s.run(ctx, v, report, fn)
+	}
+}
+
+// assert runs an assertion on its own
+func (s *Plan) assert(ctx context.Context, v *astVertex) *Result {
+	res, attempts, err := v.execute(ctx)
+	if err != nil {
+		r := failed(err)
+		r.Attempts = attempts
+		return r
+	}
+	return &Result{Status: StatusOK, Comment: res.Comment, Output: res.Output, Attempts: attempts}
+}
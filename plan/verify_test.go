@@ -0,0 +1,47 @@
+package plan
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Cidan/pepper/action"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteAssertions(t *testing.T) {
+	p := New()
+	assert.Nil(t, p.ReadFile("testdata/valid/assert.hcl"))
+	assert.Nil(t, p.Generate())
+	report, err := p.Execute(action.WithRoot(context.Background(), "testdata"))
+	assert.Error(t, err)
+
+	// Assertions run after every other state
+	var addrs []string
+	for _, r := range report.Results {
+		addrs = append(addrs, r.Address)
+	}
+	assert.Equal(t, []string{
+		"test.run.setup",
+		"assert.file_exists.fixtures",
+		"assert.file_contains.missing",
+	}, addrs)
+	assert.Equal(t, StatusOK, report.Results[1].Status)
+	assert.Equal(t, StatusFailed, report.Results[2].Status)
+	assert.Contains(t, report.Results[2].Error, `does not contain "not in the file"`)
+}
+
+func TestVerify(t *testing.T) {
+	p := New()
+	assert.Nil(t, p.ReadFile("testdata/valid/assert.hcl"))
+	assert.Nil(t, p.Generate())
+	report, err := p.Verify(action.WithRoot(context.Background(), "testdata"))
+	assert.Error(t, err)
+	assert.Len(t, report.Results, 2)
+	assert.Equal(t, "assert.file_exists.fixtures", report.Results[0].Address)
+	assert.Equal(t, StatusOK, report.Results[0].Status)
+	assert.Equal(t, StatusFailed, report.Results[1].Status)
+
+	changes, err := p.Check(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, changes, 1)
+}
@@ -0,0 +1,186 @@
+/*
+Package plugin runs state types implemented by external executables,
+in any language. A plugin is asked for its schema once, then called to
+check and apply each of its states with JSON on standard input, and
+answers with JSON on standard output. See Request and Response.
+*/
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Cidan/pepper/action"
+	"github.com/Cidan/pepper/schema"
+	"github.com/Cidan/pepper/states"
+)
+
+// DefaultTimeout is how long a plugin may take to answer a call
+const DefaultTimeout = 5 * time.Minute
+
+// Load registers every executable in dir as a state type, and returns
+// their definitions. A missing dir holds no plugins. On error, the
+// definitions registered before it are returned.
+func Load(dir string, timeout time.Duration) ([]*states.Definition, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var defs []*states.Definition
+	for _, f := range files {
+		if f.IsDir() || f.Mode()&0111 == 0 {
+			continue
+		}
+		d, err := Define(filepath.Join(dir, f.Name()), timeout)
+		if err != nil {
+			return defs, err
+		}
+		if err := states.Add(d); err != nil {
+			return defs, fmt.Errorf("plugin %s: %s", f.Name(), err)
+		}
+		defs = append(defs, d)
+	}
+	return defs, nil
+}
+
+// Define asks the plugin at path for its schema, and returns the
+// definition of its state type without registering it.
+func Define(path string, timeout time.Duration) (*states.Definition, error) {
+	var resp SchemaResponse
+	if _, err := call(context.Background(), path, timeout, &Request{Action: ActionSchema}, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Name == "" {
+		resp.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if len(resp.Commands) == 0 {
+		return nil, fmt.Errorf("plugin %s has no commands", resp.Name)
+	}
+
+	d := &states.Definition{
+		Name:        resp.Name,
+		Description: resp.Description,
+	}
+	for _, c := range resp.Commands {
+		sc, err := c.State()
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s: %s: %s", resp.Name, c.Command, err)
+		}
+		d.Commands = append(d.Commands, sc)
+	}
+
+	watch := resp.Watch
+	d.New = func(command string) states.States {
+		s := State{path: path, command: command, timeout: timeout}
+		if watch {
+			return &watchingState{s}
+		}
+		return &s
+	}
+	return d, nil
+}
+
+// State returns the schema of the command
+func (c CommandResponse) State() (*schema.State, error) {
+	sc := &schema.State{
+		Command:     c.Command,
+		Description: c.Description,
+		Schema:      map[string]*schema.Schema{},
+	}
+	names := make([]string, 0, len(c.Attributes))
+	for k := range c.Attributes {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		a := c.Attributes[k]
+		t, ok := schema.ParseValueType(a.Type)
+		if !ok {
+			return nil, fmt.Errorf("attribute %q has unknown type %q", k, a.Type)
+		}
+		s := &schema.Schema{
+			Type:        t,
+			Required:    a.Required,
+			Optional:    !a.Required,
+			Default:     a.Default,
+			Description: a.Description,
+		}
+		if a.Elem != "" {
+			elem, ok := schema.ParseValueType(a.Elem)
+			if !ok {
+				return nil, fmt.Errorf("attribute %q has unknown element type %q", k, a.Elem)
+			}
+			s.Elem = &schema.Schema{Type: elem}
+		}
+		sc.Schema[k] = s
+	}
+	return sc, nil
+}
+
+// State is a state implemented by a plugin. Its attributes are passed
+// to the plugin as they were validated against its schema.
+type State struct {
+	Attributes map[string]interface{} `mapstructure:",remain"`
+	path       string
+	command    string
+	timeout    time.Duration
+}
+
+// Merge two plugin states together
+func (s *State) Merge(b states.States) {
+
+}
+
+// Check asks the plugin what applying the state would change
+func (s *State) Check(ctx context.Context) (*states.Result, error) {
+	return s.call(ctx, ActionCheck)
+}
+
+// Execute asks the plugin to apply the state
+func (s *State) Execute(ctx context.Context) (*states.Result, error) {
+	return s.call(ctx, ActionApply)
+}
+
+func (s *State) call(ctx context.Context, name string) (*states.Result, error) {
+	var resp Response
+	stderr, err := call(ctx, s.path, s.timeout, &Request{
+		Action:     name,
+		Command:    s.command,
+		Attributes: s.Attributes,
+		Root:       action.RootFrom(ctx),
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%s %s: %s", filepath.Base(s.path), name, resp.Error)
+	}
+	return &states.Result{
+		Changed: resp.Changed,
+		Comment: resp.Comment,
+		Output:  stderr + resp.Output,
+		Reboot:  resp.Reboot,
+		Changes: resp.Changes,
+	}, nil
+}
+
+// watchingState is the state of a plugin that reacts to changes of
+// the states it watches.
+type watchingState struct {
+	State `mapstructure:",squash"`
+}
+
+// Watch tells the plugin a state it watches has changed
+func (s *watchingState) Watch(ctx context.Context) (*states.Result, error) {
+	return s.call(ctx, ActionWatch)
+}
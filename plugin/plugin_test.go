@@ -0,0 +1,91 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Cidan/pepper/plan"
+	"github.com/Cidan/pepper/states"
+	"github.com/stretchr/testify/assert"
+)
+
+var load sync.Once
+
+// loadTestdata registers the test plugins once, since a type cannot
+// be registered twice.
+func loadTestdata(t *testing.T) {
+	load.Do(func() {
+		defs, err := Load("testdata", time.Second)
+		assert.Nil(t, err)
+		assert.Len(t, defs, 2)
+	})
+}
+
+func TestLoad(t *testing.T) {
+	loadTestdata(t)
+	d, ok := states.Lookup("greet")
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, "Greets people.", d.Description)
+	c, ok := d.Command("hello")
+	if assert.True(t, ok) {
+		assert.Equal(t, []string{"also", "times", "who"}, c.Attributes())
+		assert.True(t, c.Schema["who"].Required)
+		assert.Equal(t, 1.0, c.Schema["times"].Default)
+	}
+
+	defs, err := Load("testdata/missing", time.Second)
+	assert.Nil(t, err)
+	assert.Empty(t, defs)
+}
+
+func TestExecute(t *testing.T) {
+	loadTestdata(t)
+	p := plan.New()
+	assert.Nil(t, p.Add("greet.hello.world", plan.Attrs{"who": "world"}))
+	assert.Nil(t, p.Add("broken.run.fails", plan.Attrs{"order": "last"}))
+	assert.Nil(t, p.Generate())
+
+	report, err := p.Execute(context.Background())
+	assert.Error(t, err)
+	greet, broken := report.Results[0], report.Results[1]
+	assert.Equal(t, plan.StatusChanged, greet.Status)
+	assert.Equal(t, "greeted", greet.Comment)
+	assert.Equal(t, `{"action":"apply","command":"hello","attributes":{"times":1,"who":"world"},"root":"/"}`+"\nhello\n", greet.Output)
+	assert.Equal(t, plan.StatusFailed, broken.Status)
+	assert.Contains(t, broken.Error, "broken apply: exit status 3: something went wrong")
+
+	// Plugin states are validated against the schema of the plugin
+	p = plan.New()
+	assert.Nil(t, p.Add("greet.hello.nobody", nil))
+	assert.EqualError(t, p.Generate(), `greet.hello.nobody: missing required attribute "who"`)
+}
+
+func TestState(t *testing.T) {
+	d, err := Define("testdata/broken", 100*time.Millisecond)
+	assert.Nil(t, err)
+	s := d.New("run").(*State)
+
+	_, err = s.Check(context.Background())
+	assert.EqualError(t, err, "broken check: cannot check")
+
+	// Exit codes are kept, so a retry block can stop on them
+	_, err = s.Execute(context.Background())
+	var exit interface{ ExitCode() int }
+	if assert.True(t, errors.As(err, &exit)) {
+		assert.Equal(t, 3, exit.ExitCode())
+	}
+
+	s.Attributes = map[string]interface{}{"hang": true}
+	started := time.Now()
+	_, err = s.Execute(context.Background())
+	assert.EqualError(t, err, "testdata/broken apply: timed out after 100ms")
+	assert.True(t, time.Since(started) < 5*time.Second)
+
+	_, ok := d.New("run").(states.Watcher)
+	assert.False(t, ok)
+}
@@ -0,0 +1,121 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Cidan/pepper/action"
+)
+
+// Actions a plugin is called with. The action is the only argument
+// given to the plugin executable, and a Request is written to its
+// standard input.
+const (
+	ActionSchema = "schema"
+	ActionCheck  = "check"
+	ActionApply  = "apply"
+	ActionWatch  = "watch"
+)
+
+// Request is written to the standard input of a plugin. Command and
+// Attributes are empty for the schema action. Root is the directory
+// of the system being managed, which is / unless pepper runs with
+// -root.
+type Request struct {
+	Action     string                 `json:"action"`
+	Command    string                 `json:"command,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Root       string                 `json:"root,omitempty"`
+}
+
+// Response is what a plugin prints on standard output for the check,
+// apply and watch actions. A plugin fails by setting Error or by
+// exiting non-zero. Anything printed on standard error is kept as the
+// output of the state. Changes optionally names the attributes that
+// do not match the system.
+type Response struct {
+	Changed bool     `json:"changed"`
+	Comment string   `json:"comment,omitempty"`
+	Output  string   `json:"output,omitempty"`
+	Reboot  bool     `json:"reboot,omitempty"`
+	Changes []string `json:"changes,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// SchemaResponse is what a plugin prints for the schema action. Name
+// defaults to the name of the executable. A plugin that sets Watch is
+// called with the watch action when a state it watches changes.
+type SchemaResponse struct {
+	Name        string            `json:"name,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Watch       bool              `json:"watch,omitempty"`
+	Commands    []CommandResponse `json:"commands"`
+}
+
+// CommandResponse describes a single command of a plugin
+type CommandResponse struct {
+	Command     string                        `json:"command"`
+	Description string                        `json:"description,omitempty"`
+	Attributes  map[string]*AttributeResponse `json:"attributes"`
+}
+
+// AttributeResponse describes an attribute. Type and Elem are value
+// type names, such as "string" or "list", and Elem is the type of the
+// elements of a list or map.
+type AttributeResponse struct {
+	Type        string      `json:"type"`
+	Elem        string      `json:"elem,omitempty"`
+	Required    bool        `json:"required,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+	Description string      `json:"description,omitempty"`
+}
+
+// call runs the plugin at path with the request, and decodes what it
+// prints into resp. It returns what the plugin printed on standard
+// error. The plugin is stopped once ctx is done or the timeout passes.
+func call(ctx context.Context, path string, timeout time.Duration, req *Request, resp interface{}) (string, error) {
+	in, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path, req.Action)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	}
+	cmd.WaitDelay = action.DefaultGrace
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if fn := action.OutputFrom(ctx); fn != nil {
+		lines := action.NewLineWriter(fn)
+		defer lines.Flush()
+		cmd.Stderr = io.MultiWriter(&stderr, lines)
+	}
+
+	err = cmd.Run()
+	errText := strings.TrimSpace(stderr.String())
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return stderr.String(), fmt.Errorf("%s %s: timed out after %s", path, req.Action, timeout)
+	case err != nil && errText != "":
+		return stderr.String(), fmt.Errorf("%s %s: %w: %s", path, req.Action, err, errText)
+	case err != nil:
+		return stderr.String(), fmt.Errorf("%s %s: %w", path, req.Action, err)
+	}
+	if err := json.Unmarshal(stdout.Bytes(), resp); err != nil {
+		return stderr.String(), fmt.Errorf("%s %s: invalid response: %s", path, req.Action, err)
+	}
+	return stderr.String(), nil
+}
@@ -1,5 +1,10 @@
 package schema
 
+import (
+	"fmt"
+	"strings"
+)
+
 /*
 	Credit to the TerraForm team for the idea of this implementation.
 	It doesn't function quite the same, but it's similar.
@@ -16,6 +21,39 @@ const (
 	TypeMap
 )
 
+// String returns the human readable name of a value type, as
+// used in error messages and documentation.
+func (t ValueType) String() string {
+	switch t {
+	case TypeBool:
+		return "bool"
+	case TypeInt:
+		return "int"
+	case TypeFloat:
+		return "float"
+	case TypeString:
+		return "string"
+	case TypeList:
+		return "list"
+	case TypeMap:
+		return "map"
+	}
+	return "invalid"
+}
+
+// ParseValueType returns the value type with the name returned by
+// String, e.g. "list".
+func ParseValueType(name string) (ValueType, bool) {
+	for t := TypeBool; t <= TypeMap; t++ {
+		if t.String() == name {
+			return t, true
+		}
+	}
+	return TypeInvalid, false
+}
+
+// Schema describes a single attribute of a state. Elem is only used
+// for lists and maps, and must be a *Schema describing each element.
 type Schema struct {
 	Type        ValueType
 	Optional    bool
@@ -25,6 +63,119 @@ type Schema struct {
 	Description string
 }
 
+// Validate checks that v matches the schema and returns v normalized
+// to the form states expect to decode, i.e. HCL's single element list
+// of maps is collapsed into a map.
+func (s *Schema) Validate(v interface{}) (interface{}, error) {
+	switch s.Type {
+	case TypeBool:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case TypeInt:
+		switch n := v.(type) {
+		case int:
+			return n, nil
+		case int64:
+			return int(n), nil
+		case float64:
+			if n == float64(int(n)) {
+				return int(n), nil
+			}
+		}
+	case TypeFloat:
+		switch n := v.(type) {
+		case int:
+			return float64(n), nil
+		case int64:
+			return float64(n), nil
+		case float64:
+			return n, nil
+		}
+	case TypeString:
+		if str, ok := v.(string); ok {
+			return str, nil
+		}
+	case TypeList:
+		if l, ok := v.([]interface{}); ok {
+			return s.validateList(l)
+		}
+	case TypeMap:
+		switch m := v.(type) {
+		case map[string]interface{}:
+			return s.validateMap(m)
+		case []map[string]interface{}:
+			if len(m) == 1 {
+				return s.validateMap(m[0])
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid schema type %d", s.Type)
+	}
+	return nil, fmt.Errorf("must be %s, got %s", article(s.Type.String()), describe(v))
+}
+
+func (s *Schema) validateList(l []interface{}) (interface{}, error) {
+	elem, ok := s.Elem.(*Schema)
+	if !ok {
+		return l, nil
+	}
+	out := make([]interface{}, len(l))
+	for i, e := range l {
+		v, err := elem.Validate(e)
+		if err != nil {
+			return nil, fmt.Errorf("element %d %s", i, err)
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func (s *Schema) validateMap(m map[string]interface{}) (interface{}, error) {
+	elem, ok := s.Elem.(*Schema)
+	if !ok {
+		return m, nil
+	}
+	out := make(map[string]interface{}, len(m))
+	for k, e := range m {
+		v, err := elem.Validate(e)
+		if err != nil {
+			return nil, fmt.Errorf("key %q %s", k, err)
+		}
+		out[k] = v
+	}
+	return out, nil
+}
+
+// article prefixes a type name with "a" or "an"
+func article(name string) string {
+	if strings.IndexByte("aeiou", name[0]) >= 0 {
+		return "an " + name
+	}
+	return "a " + name
+}
+
+// describe returns the schema type name of an HCL decoded value
+func describe(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "nothing"
+	case bool:
+		return TypeBool.String()
+	case int, int64:
+		return TypeInt.String()
+	case float64:
+		return TypeFloat.String()
+	case string:
+		return TypeString.String()
+	case []interface{}:
+		return TypeList.String()
+	case map[string]interface{}, []map[string]interface{}:
+		return "block"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
 /*
 type ShallowWalkFn func(string, string, string, ast.Node) error
 
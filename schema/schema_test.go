@@ -0,0 +1,68 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	strings := &Schema{Type: TypeList, Elem: &Schema{Type: TypeString}}
+	var tests = []struct {
+		schema *Schema
+		in     interface{}
+		out    interface{}
+		err    string
+	}{
+		{&Schema{Type: TypeString}, "a", "a", ""},
+		{&Schema{Type: TypeString}, []interface{}{"a"}, nil, "must be a string, got list"},
+		{&Schema{Type: TypeInt}, 3.0, 3, ""},
+		{&Schema{Type: TypeInt}, 3.5, nil, "must be an int, got float"},
+		{&Schema{Type: TypeFloat}, 3, 3.0, ""},
+		{&Schema{Type: TypeBool}, "true", nil, "must be a bool, got string"},
+		{strings, []interface{}{"a", "b"}, []interface{}{"a", "b"}, ""},
+		{strings, []interface{}{"a", 1}, nil, "element 1 must be a string, got int"},
+		{&Schema{Type: TypeMap}, []map[string]interface{}{{"a": 1}}, map[string]interface{}{"a": 1}, ""},
+	}
+
+	for _, test := range tests {
+		out, err := test.schema.Validate(test.in)
+		if test.err != "" {
+			if assert.Error(t, err) {
+				assert.Equal(t, test.err, err.Error())
+			}
+			continue
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, test.out, out)
+	}
+}
+
+func TestStateValidate(t *testing.T) {
+	s := &State{
+		Command: "run",
+		Schema: map[string]*Schema{
+			"cmd":  {Type: TypeString, Required: true},
+			"user": {Type: TypeString, Optional: true, Default: "root"},
+		},
+	}
+
+	m := map[string]interface{}{"cmd": "true"}
+	assert.Nil(t, s.Validate(m))
+	assert.Equal(t, "root", m["user"])
+
+	err := s.Validate(map[string]interface{}{"extra": 1})
+	if assert.Error(t, err) {
+		assert.Equal(t, `unknown attribute "extra"; missing required attribute "cmd"`, err.Error())
+	}
+}
+
+func TestParseValueType(t *testing.T) {
+	for _, typ := range []ValueType{TypeBool, TypeInt, TypeFloat, TypeString, TypeList, TypeMap} {
+		parsed, ok := ParseValueType(typ.String())
+		assert.True(t, ok)
+		assert.Equal(t, typ, parsed)
+	}
+	_, ok := ParseValueType("invalid")
+	assert.False(t, ok)
+}
@@ -1,6 +1,87 @@
 package schema
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	multierror "github.com/hashicorp/go-multierror"
+)
+
+// State is the schema for a single command of a state type,
+// e.g. the "install" in "apt install".
 type State struct {
-	Command string
-	Schema  map[string]*Schema
+	Command     string
+	Description string
+	Schema      map[string]*Schema
+}
+
+// Validate checks the decoded attributes of a state against the
+// schema. Unknown attributes, missing required attributes and type
+// mismatches are all reported at once. Defaults are applied and
+// values are normalized in place.
+func (s *State) Validate(m map[string]interface{}) error {
+	var result *multierror.Error
+
+	for _, k := range sortedKeys(m) {
+		attr, ok := s.Schema[k]
+		if !ok {
+			result = multierror.Append(result, fmt.Errorf("unknown attribute %q", k))
+			continue
+		}
+		v, err := attr.Validate(m[k])
+		if err != nil {
+			result = multierror.Append(result, fmt.Errorf("attribute %q %s", k, err))
+			continue
+		}
+		m[k] = v
+	}
+
+	for _, k := range s.Attributes() {
+		if _, ok := m[k]; ok {
+			continue
+		}
+		attr := s.Schema[k]
+		if attr.Required {
+			result = multierror.Append(result, fmt.Errorf("missing required attribute %q", k))
+			continue
+		}
+		if attr.Default != nil {
+			m[k] = attr.Default
+		}
+	}
+
+	if result != nil {
+		result.ErrorFormat = errorFormat
+	}
+	return result.ErrorOrNil()
+}
+
+// errorFormat joins validation errors on a single line so they read
+// naturally after the address of the offending state.
+func errorFormat(es []error) string {
+	msgs := make([]string, len(es))
+	for i, err := range es {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Attributes returns the attribute names of this state, sorted.
+func (s *State) Attributes() []string {
+	keys := make([]string, 0, len(s.Schema))
+	for k := range s.Schema {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
@@ -0,0 +1,218 @@
+package script
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/Cidan/pepper/action"
+	"github.com/Cidan/pepper/facts"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// contextKey is the thread local holding the context of a call
+const contextKey = "context"
+
+// Builtins are the only way scripts reach the system:
+//
+//	run(cmd, *args)        runs a command with the state runner, and
+//	                       returns a struct of output and exit_code
+//	read_file(path)        returns the content of a file, or None
+//	write_file(path, data, mode=0o644)
+//	file_exists(path)      returns True if the file exists
+//	facts()                returns a dict of the facts of the host
+//
+// Paths are absolute, and resolved under the managed root. They may
+// not go through symlinks, so that they cannot lead out of it.
+var Builtins = starlark.StringDict{
+	"run":         starlark.NewBuiltin("run", run),
+	"read_file":   starlark.NewBuiltin("read_file", readFile),
+	"write_file":  starlark.NewBuiltin("write_file", writeFile),
+	"file_exists": starlark.NewBuiltin("file_exists", fileExists),
+	"facts":       starlark.NewBuiltin("facts", hostFacts),
+}
+
+// callContext returns the context of the check, apply or watch call
+// the thread runs, failing if it was cancelled.
+func callContext(thread *starlark.Thread, b *starlark.Builtin) (context.Context, error) {
+	ctx, ok := thread.Local(contextKey).(context.Context)
+	if !ok {
+		return nil, fmt.Errorf("%s: only available in check, apply and watch", b.Name())
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %s", b.Name(), err)
+	}
+	return ctx, nil
+}
+
+// exitCoder is implemented by the errors of commands that exited
+// non-zero.
+type exitCoder interface {
+	ExitCode() int
+}
+
+func run(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	ctx, err := callContext(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 || len(kwargs) > 0 {
+		return nil, fmt.Errorf("run: takes a command and its arguments")
+	}
+	argv := make([]string, len(args))
+	for i, a := range args {
+		s, ok := starlark.AsString(a)
+		if !ok {
+			return nil, fmt.Errorf("run: argument %d must be a string, got %s", i, a.Type())
+		}
+		argv[i] = s
+	}
+
+	out, err := action.FromContext(ctx).Run(ctx, argv[0], argv[1:]...)
+	code := 0
+	if err != nil {
+		var e exitCoder
+		if !errors.As(err, &e) {
+			return nil, fmt.Errorf("run: %s", err)
+		}
+		code = e.ExitCode()
+	}
+	return starlarkstruct.FromStringDict(starlark.String("result"), starlark.StringDict{
+		"output":    starlark.String(out),
+		"exit_code": starlark.MakeInt(code),
+	}), nil
+}
+
+func readFile(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var path string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path", &path); err != nil {
+		return nil, err
+	}
+	f, err := open(thread, b, path, syscall.O_RDONLY, 0)
+	if os.IsNotExist(err) {
+		return starlark.None, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", b.Name(), err)
+	}
+	return starlark.String(data), nil
+}
+
+func writeFile(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var path, data string
+	mode := 0644
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path", &path, "data", &data, "mode?", &mode); err != nil {
+		return nil, err
+	}
+	f, err := open(thread, b, path, syscall.O_WRONLY|syscall.O_CREAT|syscall.O_TRUNC, uint32(mode))
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.Write([]byte(data))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", b.Name(), err)
+	}
+	return starlark.None, nil
+}
+
+func fileExists(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var path string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path", &path); err != nil {
+		return nil, err
+	}
+	f, err := open(thread, b, path, syscall.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if os.IsNotExist(err) {
+		return starlark.False, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return starlark.True, nil
+}
+
+func hostFacts(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	ctx, err := callContext(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	f, err := facts.GatherFrom(action.RootFrom(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", b.Name(), err)
+	}
+	d := starlark.NewDict(len(f))
+	for k, v := range f {
+		d.SetKey(starlark.String(k), starlark.String(v))
+	}
+	return d, nil
+}
+
+// open opens path under the managed root, failing if it is not
+// absolute or goes through a symlink. Errors for files that do not
+// exist satisfy os.IsNotExist.
+func open(thread *starlark.Thread, b *starlark.Builtin, path string, flag int, perm uint32) (*os.File, error) {
+	ctx, err := callContext(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("%s: path %q must be absolute", b.Name(), path)
+	}
+	f, err := openBeneath(action.RootFrom(ctx), path, flag, perm)
+	switch {
+	case err == nil:
+		return f, nil
+	case os.IsNotExist(err):
+		return nil, err
+	case errors.Is(err, syscall.ELOOP) || errors.Is(err, syscall.ENOTDIR):
+		return nil, fmt.Errorf("%s: path %q goes through a symlink or a file", b.Name(), path)
+	}
+	return nil, fmt.Errorf("%s: %s", b.Name(), err)
+}
+
+// openBeneath opens path under root one component at a time, without
+// following symlinks, so that it cannot lead out of root however the
+// files under root change meanwhile. Parent directories in path are
+// dropped by cleaning it, as they cannot go above /.
+func openBeneath(root, path string, flag int, perm uint32) (*os.File, error) {
+	dir, err := syscall.Open(root, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: root, Err: err}
+	}
+	name := "."
+	if rel := strings.TrimPrefix(filepath.Clean(path), "/"); rel != "" {
+		parts := strings.Split(rel, "/")
+		for _, part := range parts[:len(parts)-1] {
+			fd, err := syscall.Openat(dir, part, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_NOFOLLOW|syscall.O_CLOEXEC, 0)
+			syscall.Close(dir)
+			if err != nil {
+				return nil, &os.PathError{Op: "open", Path: path, Err: err}
+			}
+			dir = fd
+		}
+		name = parts[len(parts)-1]
+	}
+	fd, err := syscall.Openat(dir, name, flag|syscall.O_NOFOLLOW|syscall.O_CLOEXEC, perm)
+	syscall.Close(dir)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
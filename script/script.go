@@ -0,0 +1,265 @@
+/*
+Package script defines state types in Starlark, a small dialect of
+Python. Every .star file in the state directory is a state type named
+after the file, declaring its commands and check and apply functions:
+
+	description = "Writes a greeting."
+
+	commands = {
+	    "write": {
+	        "description": "Writes a greeting to a file.",
+	        "attributes": {
+	            "path": {"type": "string", "required": True},
+	            "who": {"type": "string", "default": "world"},
+	        },
+	    },
+	}
+
+	def check(command, attrs):
+	    want = "hello %s\n" % attrs["who"]
+	    return {"changed": read_file(attrs["path"]) != want}
+
+	def apply(command, attrs):
+	    write_file(attrs["path"], "hello %s\n" % attrs["who"])
+	    return {"changed": True, "comment": "wrote " + attrs["path"]}
+
+check and apply return a dict of changed, comment, output and reboot,
+or None if nothing changed. A script may define watch the same way, to
+react when a state it watches changes. Scripts only reach the system
+through the builtins listed in Builtins.
+*/
+package script
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Cidan/pepper/action"
+	"github.com/Cidan/pepper/plugin"
+	"github.com/Cidan/pepper/schema"
+	"github.com/Cidan/pepper/states"
+	"go.starlark.net/starlark"
+)
+
+// Ext is the extension of script files
+const Ext = ".star"
+
+// Load registers every script in dir as a state type, and returns their
+// definitions. A missing dir holds no scripts. On error, the
+// definitions registered before it are returned.
+func Load(dir string) ([]*states.Definition, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var defs []*states.Definition
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != Ext {
+			continue
+		}
+		d, err := Define(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return defs, err
+		}
+		if err := states.Add(d); err != nil {
+			return defs, fmt.Errorf("script %s: %s", f.Name(), err)
+		}
+		defs = append(defs, d)
+	}
+	return defs, nil
+}
+
+// Define runs the script at path and returns the definition of its
+// state type without registering it.
+func Define(path string) (*states.Definition, error) {
+	name := strings.TrimSuffix(filepath.Base(path), Ext)
+	thread := &starlark.Thread{Name: name}
+	globals, err := starlark.ExecFile(thread, path, nil, Builtins)
+	if err != nil {
+		return nil, err
+	}
+	globals.Freeze()
+
+	s := &script{name: name, globals: globals}
+	for _, fn := range []string{"check", "apply"} {
+		if _, ok := globals[fn].(starlark.Callable); !ok {
+			return nil, fmt.Errorf("script %s: missing function %s", name, fn)
+		}
+	}
+
+	d := &states.Definition{Name: name}
+	if desc, ok := globals["description"]; ok {
+		d.Description, _ = starlark.AsString(desc)
+	}
+	if d.Commands, err = s.commands(); err != nil {
+		return nil, fmt.Errorf("script %s: %s", name, err)
+	}
+
+	_, watch := globals["watch"].(starlark.Callable)
+	d.New = func(command string) states.States {
+		st := State{script: s, command: command}
+		if watch {
+			return &watchingState{st}
+		}
+		return &st
+	}
+	return d, nil
+}
+
+// script is a loaded script file
+type script struct {
+	name    string
+	globals starlark.StringDict
+}
+
+// commands reads the commands global, which describes the commands
+// of the script like the schema of a plugin.
+func (s *script) commands() ([]*schema.State, error) {
+	v, ok := s.globals["commands"]
+	if !ok {
+		return nil, fmt.Errorf("missing commands")
+	}
+	goV, err := fromStarlark(v)
+	if err != nil {
+		return nil, fmt.Errorf("commands: %s", err)
+	}
+	m, ok := goV.(map[string]interface{})
+	if !ok || len(m) == 0 {
+		return nil, fmt.Errorf("commands must be a dict of commands")
+	}
+
+	var out []*schema.State
+	for _, name := range sortedKeys(m) {
+		// The description of a command has the same shape as the
+		// schema a plugin returns.
+		b, err := json.Marshal(m[name])
+		if err != nil {
+			return nil, err
+		}
+		c := plugin.CommandResponse{Command: name}
+		if err := json.Unmarshal(b, &c); err != nil {
+			return nil, fmt.Errorf("command %s: %s", name, err)
+		}
+		sc, err := c.State()
+		if err != nil {
+			return nil, fmt.Errorf("command %s: %s", name, err)
+		}
+		out = append(out, sc)
+	}
+	return out, nil
+}
+
+// call calls the function fn of the script
+func (s *script) call(ctx context.Context, fn, command string, attrs map[string]interface{}) (*states.Result, error) {
+	thread := &starlark.Thread{
+		Name: s.name,
+		Print: func(_ *starlark.Thread, msg string) {
+			if out := action.OutputFrom(ctx); out != nil {
+				out(msg)
+			}
+		},
+	}
+	thread.SetLocal(contextKey, ctx)
+
+	// Stop the script when the state times out or the run is
+	// interrupted, even if it never calls a builtin.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			thread.Cancel(ctx.Err().Error())
+		case <-done:
+		}
+	}()
+
+	v, err := starlark.Call(thread, s.globals[fn], starlark.Tuple{
+		starlark.String(command),
+		toStarlark(attrs),
+	}, nil)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%s %s: %s", s.name, fn, ctx.Err())
+		}
+		if e, ok := err.(*starlark.EvalError); ok {
+			return nil, fmt.Errorf("%s %s: %s", s.name, fn, e.Backtrace())
+		}
+		return nil, fmt.Errorf("%s %s: %s", s.name, fn, err)
+	}
+	return result(v)
+}
+
+// result converts what check, apply or watch returned
+func result(v starlark.Value) (*states.Result, error) {
+	if v == starlark.None {
+		return &states.Result{}, nil
+	}
+	goV, err := fromStarlark(v)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := goV.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("must return a dict or None, got %s", v.Type())
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var resp plugin.Response
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return nil, fmt.Errorf("invalid result: %s", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
+	return &states.Result{
+		Changed: resp.Changed,
+		Comment: resp.Comment,
+		Output:  resp.Output,
+		Reboot:  resp.Reboot,
+		Changes: resp.Changes,
+	}, nil
+}
+
+// State is a state implemented by a script. Its attributes are passed
+// to the script as they were validated against its commands.
+type State struct {
+	Attributes map[string]interface{} `mapstructure:",remain"`
+	script     *script
+	command    string
+}
+
+// Merge two script states together
+func (s *State) Merge(b states.States) {
+
+}
+
+// Check calls the check function of the script
+func (s *State) Check(ctx context.Context) (*states.Result, error) {
+	return s.script.call(ctx, "check", s.command, s.Attributes)
+}
+
+// Execute calls the apply function of the script
+func (s *State) Execute(ctx context.Context) (*states.Result, error) {
+	return s.script.call(ctx, "apply", s.command, s.Attributes)
+}
+
+// watchingState is the state of a script that defines watch
+type watchingState struct {
+	State `mapstructure:",squash"`
+}
+
+// Watch calls the watch function of the script
+func (s *watchingState) Watch(ctx context.Context) (*states.Result, error) {
+	return s.script.call(ctx, "watch", s.command, s.Attributes)
+}
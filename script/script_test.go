@@ -0,0 +1,185 @@
+package script
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Cidan/pepper/action"
+	"github.com/Cidan/pepper/plan"
+	"github.com/Cidan/pepper/states"
+	"github.com/stretchr/testify/assert"
+	"go.starlark.net/starlark"
+)
+
+var load sync.Once
+
+// loadTestdata registers the test scripts once, since a type cannot
+// be registered twice.
+func loadTestdata(t *testing.T) {
+	load.Do(func() {
+		defs, err := Load("testdata")
+		assert.Nil(t, err)
+		assert.Len(t, defs, 2)
+	})
+}
+
+func TestLoad(t *testing.T) {
+	loadTestdata(t)
+	d, ok := states.Lookup("greeting")
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, "Writes a greeting.", d.Description)
+	c, ok := d.Command("write")
+	if assert.True(t, ok) {
+		assert.Equal(t, "Writes a greeting to a file.", c.Description)
+		assert.True(t, c.Schema["path"].Required)
+		assert.Equal(t, "world", c.Schema["who"].Default)
+	}
+	_, ok = d.New("write").(states.Watcher)
+	assert.False(t, ok)
+}
+
+func TestExecute(t *testing.T) {
+	loadTestdata(t)
+	root, err := ioutil.TempDir("", "script")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+	ctx := action.WithRoot(context.Background(), root)
+
+	p := plan.New()
+	assert.Nil(t, p.Add("greeting.write.motd", plan.Attrs{"path": "/motd"}))
+	assert.Nil(t, p.Add("uname.print.kernel", plan.Attrs{"watch": "greeting.write.motd"}))
+	assert.Nil(t, p.Generate())
+
+	changes, err := p.Check(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "would write /motd", changes[0].Comment)
+
+	report, err := p.Execute(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "wrote /motd", report.Results[0].Comment)
+	assert.Equal(t, "Linux on linux; exit 1", report.Results[1].Comment)
+	data, err := ioutil.ReadFile(filepath.Join(root, "motd"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello world\n", string(data))
+
+	// The file is written, so nothing changes the second time
+	report, err = p.Execute(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, plan.StatusOK, report.Results[0].Status)
+}
+
+func TestSandbox(t *testing.T) {
+	loadTestdata(t)
+	root, err := ioutil.TempDir("", "script")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+	outside, err := ioutil.TempDir("", "outside")
+	assert.Nil(t, err)
+	defer os.RemoveAll(outside)
+	assert.Nil(t, os.Symlink(outside, filepath.Join(root, "escape")))
+	ctx := action.WithRoot(context.Background(), root)
+
+	d, _ := states.Lookup("greeting")
+	s := d.New("write").(*State)
+	s.Attributes = map[string]interface{}{"path": "/escape/motd", "who": "world"}
+	_, err = s.Execute(ctx)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `read_file: path "/escape/motd" goes through a symlink`)
+	}
+
+	// Nor can a dangling symlink to a file outside
+	shadow := filepath.Join(outside, "shadow")
+	assert.Nil(t, os.Symlink(shadow, filepath.Join(root, "dangling")))
+	s.Attributes["path"] = "/dangling"
+	_, err = s.Execute(ctx)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `read_file: path "/dangling" goes through a symlink`)
+	}
+	thread := &starlark.Thread{}
+	thread.SetLocal(contextKey, ctx)
+	_, err = starlark.Call(thread, Builtins["write_file"], starlark.Tuple{starlark.String("/dangling"), starlark.String("x")}, nil)
+	assert.Error(t, err)
+	_, err = os.Lstat(shadow)
+	assert.True(t, os.IsNotExist(err))
+
+	// Parent directories cannot be used to leave the root either
+	s.Attributes["path"] = "/../../motd"
+	_, err = s.Execute(ctx)
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(root, "motd"))
+	assert.Nil(t, err)
+
+	s.Attributes["path"] = "motd"
+	_, err = s.Execute(ctx)
+	assert.Error(t, err)
+}
+
+func TestFail(t *testing.T) {
+	loadTestdata(t)
+	d, _ := states.Lookup("uname")
+	s := d.New("print").(*watchingState)
+	s.Attributes = map[string]interface{}{"fail": true}
+	_, err := s.Execute(context.Background())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "asked to fail")
+	}
+}
+
+func TestCancel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "script")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "spin.star")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(`commands = {"forever": {}}
+
+def check(command, attrs):
+    for i in range(1 << 40):
+        pass
+
+def apply(command, attrs):
+    pass
+`), 0644))
+	d, err := Define(path)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = d.New("forever").Check(ctx)
+	assert.EqualError(t, err, "spin check: context deadline exceeded")
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestDefineInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "script")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	var tests = []struct {
+		src string
+		err string
+	}{
+		{`commands = {"x": {}}`, "script bad: missing function check"},
+		{"def check(c, a): pass\ndef apply(c, a): pass", "script bad: missing commands"},
+		{"commands = {\"x\": {\"attributes\": {\"a\": {\"type\": \"number\"}}}}\n" +
+			"def check(c, a): pass\ndef apply(c, a): pass",
+			`script bad: command x: attribute "a" has unknown type "number"`},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, "bad.star")
+		assert.Nil(t, ioutil.WriteFile(path, []byte(test.src), 0644))
+		_, err := Define(path)
+		if assert.Error(t, err) {
+			assert.Equal(t, test.err, err.Error())
+		}
+	}
+}
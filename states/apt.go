@@ -1,52 +1,202 @@
 package states
 
 import (
+	"context"
+	"fmt"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/Cidan/pepper/action"
+	"github.com/Cidan/pepper/lock"
+	"github.com/Cidan/pepper/schema"
 	"github.com/blang/semver"
 	"github.com/rs/zerolog/log"
 )
 
 // Apt state for handling apt installs
 type Apt struct {
-	AllowNoVersion bool     `mapstructure:"allow_no_version"`
-	Packages       []string `mapstructure:"packages"`
-	shell          *action.Shell
+	AllowNoVersion bool                      `mapstructure:"allow_no_version"`
+	Packages       []string                  `mapstructure:"packages"`
 	installed      map[string]semver.Version // name and version
 	cmd            string
 }
 
+// dpkgLock is the lock apt and dpkg hold while changing packages
+var dpkgLock = "/var/lib/dpkg/lock-frontend"
+
+// dpkgLockWait is how long to wait for another package manager, such
+// as unattended-upgrades, to release the dpkg lock.
+const dpkgLockWait = 10 * time.Minute
+
+func init() {
+	Register(&Definition{
+		Name:        "apt",
+		Description: "Manages Debian packages with apt-get.",
+		Commands: []*schema.State{
+			{
+				Command:     "install",
+				Description: "Installs a list of packages, updating the package index first.",
+				Schema: map[string]*schema.Schema{
+					"packages": {
+						Type:        schema.TypeList,
+						Required:    true,
+						Elem:        &schema.Schema{Type: schema.TypeString},
+						Description: "Names of the packages to install.",
+					},
+					"allow_no_version": {
+						Type:        schema.TypeBool,
+						Optional:    true,
+						Default:     false,
+						Description: "Allow packages to be listed without a pinned version.",
+					},
+				},
+			},
+		},
+		New: func(command string) States {
+			return &Apt{cmd: command}
+		},
+	})
+}
+
 // Merge two apt states together
 func (a *Apt) Merge(b States) {
 
 }
 
-func (a *Apt) Execute() {
-	a.pre()
-	err := a.run()
+// Check reports which packages would be installed
+func (a *Apt) Check(ctx context.Context) (*Result, error) {
+	missing, err := a.missing(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) == 0 {
+		return &Result{Comment: "all packages are installed"}, nil
+	}
+	return &Result{
+		Changed: true,
+		Comment: "would install " + strings.Join(missing, ", "),
+		Changes: []string{"packages"},
+	}, nil
+}
+
+// Execute installs every package that is not installed yet
+func (a *Apt) Execute(ctx context.Context) (*Result, error) {
+	missing, err := a.missing(ctx)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	if len(missing) == 0 {
+		return &Result{Comment: "all packages are installed"}, nil
+	}
+
+	if err := waitDpkg(ctx); err != nil {
+		return nil, err
+	}
+	if err := a.pre(ctx); err != nil {
+		return nil, err
+	}
+	out, err := a.run(ctx, missing)
+	if err != nil {
+		return nil, aptError("install", out, err)
 	}
 	a.post()
+	return &Result{
+		Changed: true,
+		Comment: "installed " + strings.Join(missing, ", "),
+		Output:  out,
+	}, nil
 }
 
-// Pre runs apt update, collects installed packages
-// and excludes already installed packages.
-func (a *Apt) pre() {
+// Pre runs apt update
+func (a *Apt) pre(ctx context.Context) error {
 	// Globalize this cache
 	log.Info().Msg("Updating APT")
-	cmd := exec.Command("apt-get", "update")
-	cmd.Run()
+	b, err := action.FromContext(ctx).Run(ctx, "apt-get", append(lockTimeout(), "update")...)
+	if err != nil {
+		return aptError("update", string(b), err)
+	}
+	return nil
+}
+
+// aptError wraps the error of an apt-get command with its output
+func aptError(command, output string, err error) error {
+	if out := strings.TrimSpace(output); out != "" {
+		return fmt.Errorf("apt-get %s: %w: %s", command, err, out)
+	}
+	return fmt.Errorf("apt-get %s: %w", command, err)
+}
+
+// missing returns the packages that are not installed, according
+// to dpkg.
+func (a *Apt) missing(ctx context.Context) ([]string, error) {
+	names := make([]string, len(a.Packages))
+	for i, p := range a.Packages {
+		names[i] = strings.SplitN(p, "=", 2)[0]
+	}
+
+	args := append([]string{"-W", "-f=${Package} ${Status}\n"}, names...)
+	out, err := action.FromContext(ctx).Run(ctx, "dpkg-query", args...)
+	// dpkg-query exits non-zero when a package is unknown, which
+	// only means it is not installed.
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		return nil, err
+	}
+
+	installed := map[string]bool{}
+	for _, line := range strings.Split(string(out), "\n") {
+		f := strings.Fields(line)
+		if len(f) == 4 && f[3] == "installed" {
+			installed[f[0]] = true
+		}
+	}
+
+	var missing []string
+	for i, name := range names {
+		if !installed[name] {
+			missing = append(missing, a.Packages[i])
+		}
+	}
+	return missing, nil
+}
+
+// waitDpkg waits until no other process holds the dpkg lock, so that
+// apt-get does not fail when it runs at the same time as another
+// package manager.
+func waitDpkg(ctx context.Context) error {
+	path := filepath.Join(action.RootFrom(ctx), dpkgLock)
+	deadline := time.Now().Add(dpkgLockWait)
+	for {
+		pid, err := lock.RecordHolder(path)
+		if err != nil || pid == 0 {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s is still held by pid %d after %s", path, pid, dpkgLockWait)
+		}
+		log.Info().Int("pid", pid).Str("lock", path).Msg("Waiting for the dpkg lock")
+		select {
+		case <-time.After(5 * time.Second):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// lockTimeout has apt-get itself wait for the dpkg lock, in case it
+// is taken again between waitDpkg and apt-get starting.
+func lockTimeout() []string {
+	return []string{"-o", fmt.Sprintf("DPkg::Lock::Timeout=%d", int(dpkgLockWait.Seconds()))}
 }
 
 // Generate a command line run for what actions
 // will be taken.
-func (a *Apt) run() error {
+func (a *Apt) run(ctx context.Context, packages []string) (string, error) {
 
 	// TODO: install, remove, purge, update options
-	log.Info().Strs("packages", a.Packages).Msg("Installing packages")
-	args := append([]string{
+	log.Info().Strs("packages", packages).Msg("Installing packages")
+	args := append(lockTimeout(),
 		"-q",
 		"-y",
 		"--force-yes",
@@ -55,23 +205,37 @@ func (a *Apt) run() error {
 		"-o",
 		"DPkg::Options::=--force-confold",
 		"install",
-	}, a.Packages...)
+	)
+	args = append(args, packages...)
 	log.Debug().Strs("args", args).Msg("apt args")
-	cmd := exec.Command("apt-get", args...)
-	b, err := cmd.CombinedOutput()
+	b, err := action.FromContext(ctx).Run(ctx, "apt-get", args...)
 	log.Debug().Str("output", string(b)).Msg("APT output")
 
-	return err
+	return string(b), err
 	// TODO:
 	// validate version is in packages or no version is set
-	// dpkg -l
 	// parse semver, add to list
-
-	// TODO:
-	// Check for installed packages/create a package cache.
 }
 
 // Post idk yet.
 func (a *Apt) post() {
 
 }
+
+// Script installs the packages that dpkg does not list as installed
+func (a *Apt) Script() (string, error) {
+	install := quoteAll(append(lockTimeout(),
+		"-q", "-y", "--force-yes",
+		"-o", "DPkg::Options::=--force-confdef",
+		"-o", "DPkg::Options::=--force-confold",
+		"install")...)
+	return `missing=
+for p in ` + quoteAll(a.Packages...) + `; do
+  dpkg-query -W -f='${Status}' "${p%%=*}" 2>/dev/null | grep -q ' installed$' || missing="$missing $p"
+done
+if [ -n "$missing" ]; then
+  apt-get ` + quoteAll(append(lockTimeout(), "update")...) + `
+  apt-get ` + install + ` $missing
+fi
+`, nil
+}
@@ -0,0 +1,337 @@
+package states
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Cidan/pepper/action"
+	"github.com/Cidan/pepper/schema"
+)
+
+// Assert state for checking the system is as expected. Assertions
+// never change anything, they fail when the system does not match.
+type Assert struct {
+	Path     string   `mapstructure:"path"`
+	Type     string   `mapstructure:"type"`
+	Text     string   `mapstructure:"text"`
+	Package  string   `mapstructure:"package"`
+	Port     int      `mapstructure:"port"`
+	Protocol string   `mapstructure:"protocol"`
+	Cmd      string   `mapstructure:"cmd"`
+	Args     []string `mapstructure:"args"`
+	Exit     int      `mapstructure:"exit"`
+	cmd      string
+}
+
+// procNet is where the kernel lists open sockets
+var procNet = "/proc/net"
+
+func init() {
+	path := &schema.Schema{
+		Type:        schema.TypeString,
+		Required:    true,
+		Description: "Absolute path of the file, relative to the root being applied.",
+	}
+	Register(&Definition{
+		Name:        "assert",
+		Description: "Checks the system is as expected without changing it. Assertions run after every other state, or on their own with pepper verify.",
+		Commands: []*schema.State{
+			{
+				Command:     "file_exists",
+				Description: "Passes if a file exists.",
+				Schema: map[string]*schema.Schema{
+					"path": path,
+					"type": {
+						Type:        schema.TypeString,
+						Optional:    true,
+						Description: "Kind of file expected, either file or directory. Any kind passes if unset.",
+					},
+				},
+			},
+			{
+				Command:     "file_contains",
+				Description: "Passes if a file contains the given text.",
+				Schema: map[string]*schema.Schema{
+					"path": path,
+					"text": {
+						Type:        schema.TypeString,
+						Required:    true,
+						Description: "Text the file must contain.",
+					},
+				},
+			},
+			{
+				Command:     "package_installed",
+				Description: "Passes if a Debian package is installed.",
+				Schema: map[string]*schema.Schema{
+					"package": {
+						Type:        schema.TypeString,
+						Required:    true,
+						Description: "Name of the package.",
+					},
+				},
+			},
+			{
+				Command:     "port_listening",
+				Description: "Passes if a local socket listens on a port.",
+				Schema: map[string]*schema.Schema{
+					"port": {
+						Type:        schema.TypeInt,
+						Required:    true,
+						Description: "Port number.",
+					},
+					"protocol": {
+						Type:        schema.TypeString,
+						Optional:    true,
+						Default:     "tcp",
+						Description: "Protocol of the socket, either tcp or udp.",
+					},
+				},
+			},
+			{
+				Command:     "command",
+				Description: "Passes if a command exits with the expected status.",
+				Schema: map[string]*schema.Schema{
+					"cmd": {
+						Type:        schema.TypeString,
+						Required:    true,
+						Description: "The command to run.",
+					},
+					"args": {
+						Type:        schema.TypeList,
+						Optional:    true,
+						Elem:        &schema.Schema{Type: schema.TypeString},
+						Description: "Arguments passed to the command.",
+					},
+					"exit": {
+						Type:        schema.TypeInt,
+						Optional:    true,
+						Default:     0,
+						Description: "Exit status the command must return.",
+					},
+				},
+			},
+		},
+		New: func(command string) States {
+			return &Assert{cmd: command}
+		},
+	})
+}
+
+// Merge two assert states together
+func (a *Assert) Merge(b States) {
+
+}
+
+// Check runs the assertion. Assertions never change anything, so
+// checking one is the same as executing it.
+func (a *Assert) Check(ctx context.Context) (*Result, error) {
+	return a.Execute(ctx)
+}
+
+// Execute runs the assertion, failing if it does not hold
+func (a *Assert) Execute(ctx context.Context) (*Result, error) {
+	switch a.cmd {
+	case "file_exists":
+		return a.fileExists(ctx)
+	case "file_contains":
+		return a.fileContains(ctx)
+	case "package_installed":
+		return a.packageInstalled(ctx)
+	case "port_listening":
+		return a.portListening()
+	case "command":
+		return a.command(ctx)
+	}
+	return nil, fmt.Errorf("unknown assertion %q", a.cmd)
+}
+
+// fileExists checks the file exists and is of the expected type
+func (a *Assert) fileExists(ctx context.Context) (*Result, error) {
+	path, err := a.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	switch a.Type {
+	case "":
+	case "file":
+		if !fi.Mode().IsRegular() {
+			return nil, fmt.Errorf("%s is not a regular file", a.Path)
+		}
+	case "directory":
+		if !fi.IsDir() {
+			return nil, fmt.Errorf("%s is not a directory", a.Path)
+		}
+	default:
+		return nil, fmt.Errorf("type must be file or directory, got %q", a.Type)
+	}
+	return &Result{Comment: a.Path + " exists"}, nil
+}
+
+// fileContains checks the file contains the text
+func (a *Assert) fileContains(ctx context.Context) (*Result, error) {
+	path, err := a.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(string(b), a.Text) {
+		return nil, fmt.Errorf("%s does not contain %q", a.Path, a.Text)
+	}
+	return &Result{Comment: fmt.Sprintf("%s contains %q", a.Path, a.Text)}, nil
+}
+
+// packageInstalled checks the package is installed, the same way the
+// apt state does.
+func (a *Assert) packageInstalled(ctx context.Context) (*Result, error) {
+	missing, err := (&Apt{Packages: []string{a.Package}}).missing(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("package %s is not installed", a.Package)
+	}
+	return &Result{Comment: "package " + a.Package + " is installed"}, nil
+}
+
+// portListening checks the kernel's socket tables for a socket
+// listening on the port.
+func (a *Assert) portListening() (*Result, error) {
+	protocol := a.Protocol
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	// Listening TCP sockets are in state LISTEN, bound UDP sockets in
+	// state CLOSE.
+	var state string
+	switch protocol {
+	case "tcp":
+		state = "0A"
+	case "udp":
+		state = "07"
+	default:
+		return nil, fmt.Errorf("protocol must be tcp or udp, got %q", protocol)
+	}
+
+	for _, name := range []string{protocol, protocol + "6"} {
+		ok, err := listening(filepath.Join(procNet, name), a.Port, state)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &Result{Comment: fmt.Sprintf("%s port %d is listening", protocol, a.Port)}, nil
+		}
+	}
+	return nil, fmt.Errorf("nothing listens on %s port %d", protocol, a.Port)
+}
+
+// listening returns true if the socket table at path has a socket on
+// port in the given state. Missing tables, e.g. without IPv6, hold no
+// sockets.
+func listening(path string, port int, state string) (bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[3] != state {
+			continue
+		}
+		i := strings.LastIndex(fields[1], ":")
+		p, err := strconv.ParseUint(fields[1][i+1:], 16, 16)
+		if err == nil && int(p) == port {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// command runs the command and checks its exit status
+func (a *Assert) command(ctx context.Context) (*Result, error) {
+	line := strings.Join(append([]string{a.Cmd}, a.Args...), " ")
+	b, err := action.FromContext(ctx).Run(ctx, a.Cmd, a.Args...)
+	code := 0
+	if err != nil {
+		var exit *exec.ExitError
+		if !errors.As(err, &exit) || ctx.Err() != nil {
+			return nil, fmt.Errorf("%s: %w", line, err)
+		}
+		code = exit.ExitCode()
+	}
+	if code != a.Exit {
+		if out := strings.TrimSpace(string(b)); out != "" {
+			return nil, fmt.Errorf("%s exited %d, expected %d: %s", line, code, a.Exit, out)
+		}
+		return nil, fmt.Errorf("%s exited %d, expected %d", line, code, a.Exit)
+	}
+	return &Result{Comment: fmt.Sprintf("%s exited %d", line, code), Output: string(b)}, nil
+}
+
+// resolve returns where the asserted path is under the root being
+// applied.
+func (a *Assert) resolve(ctx context.Context) (string, error) {
+	if !filepath.IsAbs(a.Path) {
+		return "", fmt.Errorf("path %q must be absolute", a.Path)
+	}
+	return filepath.Join(action.RootFrom(ctx), filepath.Clean(a.Path)), nil
+}
+
+// Script fails unless the assertion holds
+func (a *Assert) Script() (string, error) {
+	var test string
+	switch a.cmd {
+	case "file_exists":
+		flag := map[string]string{"": "-e", "file": "-f", "directory": "-d"}[a.Type]
+		if flag == "" {
+			return "", fmt.Errorf("type must be file or directory, got %q", a.Type)
+		}
+		test = "test " + flag + " " + Quote(a.Path)
+	case "file_contains":
+		test = "grep -qF -- " + quoteAll(a.Text, a.Path)
+	case "package_installed":
+		test = "dpkg-query -W -f='${Status}' " + Quote(a.Package) + " 2>/dev/null | grep -q ' installed$'"
+	case "port_listening":
+		protocol := a.Protocol
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		if protocol != "tcp" && protocol != "udp" {
+			return "", fmt.Errorf("protocol must be tcp or udp, got %q", protocol)
+		}
+		test = fmt.Sprintf("ss -Hln --%s 'sport = :%d' | grep -q .", protocol, a.Port)
+	case "command":
+		return fmt.Sprintf(`rc=0
+%s || rc=$?
+if [ $rc -ne %d ]; then
+  echo "exited $rc, expected %d" >&2
+  exit 1
+fi
+`, quoteAll(append([]string{a.Cmd}, a.Args...)...), a.Exit, a.Exit), nil
+	default:
+		return "", fmt.Errorf("unknown assertion %q", a.cmd)
+	}
+	return test + " || { echo 'assertion failed' >&2; exit 1; }\n", nil
+}
@@ -0,0 +1,16 @@
+package states
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed testdata/*.hcl
+var examples embed.FS
+
+// Examples returns the example state files of the built-in state
+// types, named type_command.hcl, which pepper docs renders.
+func Examples() fs.FS {
+	sub, _ := fs.Sub(examples, "testdata")
+	return sub
+}
@@ -0,0 +1,35 @@
+package states
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Exporter is implemented by states that can be written as a POSIX
+// shell script, for pepper export. Script returns commands applying
+// the state, guarded so that they only change what needs changing
+// where the state type can tell. The script must fail if the state
+// fails.
+type Exporter interface {
+	Script() (string, error)
+}
+
+// unquoted matches words the shell takes as they are
+var unquoted = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// Quote quotes s for a POSIX shell
+func Quote(s string) string {
+	if unquoted.MatchString(s) {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// quoteAll quotes every word and joins them with spaces
+func quoteAll(words ...string) string {
+	out := make([]string, len(words))
+	for i, w := range words {
+		out[i] = Quote(w)
+	}
+	return strings.Join(out, " ")
+}
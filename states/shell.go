@@ -1,49 +1,85 @@
 package states
 
 import (
+	"context"
+	"fmt"
+	"strings"
+
 	"github.com/Cidan/pepper/action"
+	"github.com/Cidan/pepper/schema"
 	"github.com/blang/semver"
+	"github.com/rs/zerolog/log"
 )
 
-// Apt state for handling apt installs
+// Shell state for running arbitrary commands
 type Shell struct {
-	AllowNoVersion bool     `mapstructure:"allow_no_version"`
-	Args           []string `mapstructure:"args"`
-	Cmd            string   `mapstructure:"cmd"`
-	shell          *action.Shell
-	installed      map[string]semver.Version // name and version
+	Args      []string                  `mapstructure:"args"`
+	Cmd       string                    `mapstructure:"cmd"`
+	installed map[string]semver.Version // name and version
+}
+
+func init() {
+	Register(&Definition{
+		Name:        "shell",
+		Description: "Runs arbitrary commands.",
+		Commands: []*schema.State{
+			{
+				Command:     "run",
+				Description: "Runs a command with the given arguments.",
+				Schema: map[string]*schema.Schema{
+					"cmd": {
+						Type:        schema.TypeString,
+						Required:    true,
+						Description: "The command to run.",
+					},
+					"args": {
+						Type:        schema.TypeList,
+						Optional:    true,
+						Elem:        &schema.Schema{Type: schema.TypeString},
+						Description: "Arguments passed to the command.",
+					},
+				},
+			},
+		},
+		New: func(command string) States {
+			return &Shell{}
+		},
+	})
 }
 
-// Merge two apt states together
+// Merge two shell states together
 func (a *Shell) Merge(b States) {
 
 }
 
-func (a *Shell) Execute() {
-	a.pre()
-	a.generate()
-	a.post()
+// Check reports that the command would run. Commands are not
+// idempotent, so a shell state always changes, and whether the system
+// still matches it is unknown.
+func (a *Shell) Check(ctx context.Context) (*Result, error) {
+	return &Result{Changed: true, Comment: "would run " + a.command(), Changes: []string{"cmd"}, Unknown: true}, nil
 }
 
-// Pre runs apt update, collects installed packages
-// and excludes already installed packages.
-func (a *Shell) pre() {
-	// TODO:
-	// validate version is in packages or no version is set
-	// dpkg -l
-	// parse semver, add to list
+// Execute runs the command, failing if it exits non-zero
+func (a *Shell) Execute(ctx context.Context) (*Result, error) {
+	log.Info().Str("cmd", a.command()).Msg("Running command")
+	b, err := action.FromContext(ctx).Run(ctx, a.Cmd, a.Args...)
+	log.Debug().Str("output", string(b)).Msg("Shell output")
+	if err != nil {
+		if out := strings.TrimSpace(string(b)); out != "" {
+			return nil, fmt.Errorf("%s: %w: %s", a.command(), err, out)
+		}
+		return nil, fmt.Errorf("%s: %w", a.command(), err)
+	}
+	return &Result{Changed: true, Comment: "ran " + a.command(), Output: string(b)}, nil
 }
 
-// Generate a command line run for what actions
-// will be taken.
-func (a *Shell) generate() string {
-
-	// TODO:
-	// Check for installed packages/create a package cache.
-	return "apt install -y htop"
+// command returns the full command line, for logging
+func (a *Shell) command() string {
+	return strings.Join(append([]string{a.Cmd}, a.Args...), " ")
 }
 
-// Post idk yet.
-func (a *Shell) post() {
-
+// Script runs the command. Commands are not idempotent, so it is not
+// guarded.
+func (a *Shell) Script() (string, error) {
+	return quoteAll(append([]string{a.Cmd}, a.Args...)...) + "\n", nil
 }
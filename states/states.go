@@ -1,6 +1,114 @@
 package states
 
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/Cidan/pepper/schema"
+)
+
+// States is implemented by every state type. Check reports what
+// Execute would change without changing anything. States run their
+// commands with the runner from action.FromContext, and must stop
+// when ctx is done.
 type States interface {
 	Merge(States)
-	Execute()
+	Check(ctx context.Context) (*Result, error)
+	Execute(ctx context.Context) (*Result, error)
+}
+
+// Watcher is implemented by states that react when a state they
+// watch has changed, e.g. by restarting a service.
+type Watcher interface {
+	Watch(ctx context.Context) (*Result, error)
+}
+
+// Result is the outcome of checking or executing a state. Output is
+// whatever the state's commands printed, if anything. A state sets
+// Reboot when the host must reboot before the run continues. Changes
+// names the attributes that do not match the system, when the state
+// can tell. Check sets Unknown when the state cannot tell whether the
+// system matches it, such as a command that runs every time.
+type Result struct {
+	Changed bool
+	Comment string
+	Output  string
+	Reboot  bool
+	Changes []string
+	Unknown bool
+}
+
+// Definition describes a state type, the commands it supports and
+// how to create a new instance of it for a given command.
+type Definition struct {
+	Name        string
+	Description string
+	Commands    []*schema.State
+	New         func(command string) States
+}
+
+var (
+	mu       sync.RWMutex
+	registry = map[string]*Definition{}
+)
+
+// Register adds a state type to the registry. It panics if a type
+// with the same name has already been registered.
+func Register(d *Definition) {
+	if err := Add(d); err != nil {
+		panic(err)
+	}
+}
+
+// Add adds a state type to the registry at run time, such as a plugin,
+// and returns an error if a type with the same name is registered.
+func Add(d *Definition) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := registry[d.Name]; ok {
+		return fmt.Errorf("states: type %q registered twice", d.Name)
+	}
+	registry[d.Name] = d
+	return nil
+}
+
+// Remove removes a state type added at run time from the registry
+func Remove(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(registry, name)
+}
+
+// Lookup returns the definition of a registered state type
+func Lookup(name string) (*Definition, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	d, ok := registry[name]
+	return d, ok
+}
+
+// Definitions returns every registered state type, sorted by name
+func Definitions() []*Definition {
+	mu.RLock()
+	defer mu.RUnlock()
+	defs := make([]*Definition, 0, len(registry))
+	for _, d := range registry {
+		defs = append(defs, d)
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].Name < defs[j].Name
+	})
+	return defs
+}
+
+// Command returns the schema for a command of this state type
+func (d *Definition) Command(name string) (*schema.State, bool) {
+	for _, c := range d.Commands {
+		if c.Command == name {
+			return c, true
+		}
+	}
+	return nil, false
 }
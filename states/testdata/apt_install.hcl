@@ -0,0 +1,6 @@
+apt install base_system {
+  packages = [
+    "htop",
+    "atop",
+  ]
+}
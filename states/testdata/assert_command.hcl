@@ -0,0 +1,4 @@
+assert command nginx_config_valid {
+  cmd  = "nginx"
+  args = ["-t"]
+}
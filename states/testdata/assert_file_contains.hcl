@@ -0,0 +1,4 @@
+assert file_contains sshd_no_root {
+  path = "/etc/ssh/sshd_config"
+  text = "PermitRootLogin no"
+}
@@ -0,0 +1,4 @@
+assert file_exists nginx_config {
+  path = "/etc/nginx/nginx.conf"
+  type = "file"
+}
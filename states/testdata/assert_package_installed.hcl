@@ -0,0 +1,3 @@
+assert package_installed htop {
+  package = "htop"
+}
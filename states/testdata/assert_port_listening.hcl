@@ -0,0 +1,3 @@
+assert port_listening ssh {
+  port = 22
+}
@@ -0,0 +1,4 @@
+shell run hello {
+  cmd  = "echo"
+  args = ["hello", "world"]
+}
@@ -0,0 +1,176 @@
+package testkit
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Cidan/pepper/action"
+)
+
+// Command is a command a plan ran
+type Command struct {
+	Name string
+	Args []string
+}
+
+// String returns the command line, with arguments quoted where they
+// contain spaces or quotes.
+func (c Command) String() string {
+	words := []string{c.Name}
+	for _, arg := range c.Args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\") {
+			arg = strconv.Quote(arg)
+		}
+		words = append(words, arg)
+	}
+	return strings.Join(words, " ")
+}
+
+// Handler answers a command instead of running it, with its output
+type Handler func(args []string) ([]byte, error)
+
+// Fake is a runner that records every command. Commands with a
+// handler are answered by it, and the others are passed to Next, or
+// fail if it is nil.
+type Fake struct {
+	Next action.Runner
+
+	mu       sync.Mutex
+	commands []Command
+	handlers map[string]Handler
+}
+
+// NewFake returns a Fake passing unhandled commands to next
+func NewFake(next action.Runner) *Fake {
+	return &Fake{Next: next, handlers: map[string]Handler{}}
+}
+
+// Handle answers the command name with h from now on
+func (f *Fake) Handle(name string, h Handler) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[name] = h
+}
+
+// Run records the command and answers or runs it
+func (f *Fake) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	f.mu.Lock()
+	f.commands = append(f.commands, Command{Name: name, Args: args})
+	h, ok := f.handlers[name]
+	f.mu.Unlock()
+
+	if !ok {
+		if f.Next == nil {
+			return nil, fmt.Errorf("%s: no fake for this command", name)
+		}
+		return f.Next.Run(ctx, name, args...)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	out, err := h(args)
+	if fn := action.OutputFrom(ctx); fn != nil {
+		lines := action.NewLineWriter(fn)
+		lines.Write(out)
+		lines.Flush()
+	}
+	return out, err
+}
+
+// Commands returns every command run so far, in order
+func (f *Fake) Commands() []Command {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Command(nil), f.commands...)
+}
+
+// Packages is a fake Debian package database. It answers apt-get,
+// apt and dpkg-query the way the apt state expects.
+type Packages struct {
+	mu        sync.Mutex
+	installed map[string]bool
+}
+
+// Packages answers the package managers of f from a fake database of
+// the installed packages.
+func (f *Fake) Packages(installed ...string) *Packages {
+	p := &Packages{installed: map[string]bool{}}
+	for _, name := range installed {
+		p.installed[name] = true
+	}
+	f.Handle("apt-get", p.apt)
+	f.Handle("apt", p.apt)
+	f.Handle("dpkg-query", p.query)
+	return p
+}
+
+// Installed returns the names of the installed packages, sorted
+func (p *Packages) Installed() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var names []string
+	for name := range p.installed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// apt installs or removes packages
+func (p *Packages) apt(args []string) ([]byte, error) {
+	var words []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-o":
+			i++
+		case !strings.HasPrefix(args[i], "-"):
+			words = append(words, args[i])
+		}
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("no operation given")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var out strings.Builder
+	switch op, names := words[0], words[1:]; op {
+	case "update":
+		out.WriteString("Reading package lists... Done\n")
+	case "install":
+		for _, name := range names {
+			name = strings.SplitN(name, "=", 2)[0]
+			if !p.installed[name] {
+				p.installed[name] = true
+				fmt.Fprintf(&out, "Setting up %s ...\n", name)
+			}
+		}
+	case "remove", "purge":
+		for _, name := range names {
+			if p.installed[name] {
+				delete(p.installed, name)
+				fmt.Fprintf(&out, "Removing %s ...\n", name)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid operation %s", op)
+	}
+	return []byte(out.String()), nil
+}
+
+// query lists which of the packages are installed, with their status
+func (p *Packages) query(args []string) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var out strings.Builder
+	for _, name := range args {
+		if !strings.HasPrefix(name, "-") && p.installed[name] {
+			fmt.Fprintf(&out, "%s install ok installed\n", name)
+		}
+	}
+	return []byte(out.String()), nil
+}
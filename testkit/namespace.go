@@ -0,0 +1,58 @@
+package testkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/Cidan/pepper/action"
+)
+
+// Namespace runs commands chrooted into Root, inside new user and
+// mount namespaces where the caller is root. Binds are host
+// directories mounted read only in Root, so that commands find their
+// tools and libraries. It needs no privileges, but the test binary
+// must call Main.
+type Namespace struct {
+	Root  string
+	Binds []string
+}
+
+// Run runs the command in the namespaces and returns its combined
+// output. The command is killed once ctx is done.
+func (n *Namespace) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if !mainCalled {
+		return nil, errors.New("testkit: the test binary must call testkit.Main from TestMain")
+	}
+	cmd := exec.CommandContext(ctx, "/proc/self/exe", append([]string{name}, args...)...)
+	cmd.Env = append(os.Environ(), rootEnv+"="+n.Root, bindsEnv+"="+strings.Join(n.Binds, ":"))
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid:    true,
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS,
+		UidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: os.Getuid(), Size: 1},
+		},
+		GidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: os.Getgid(), Size: 1},
+		},
+	}
+	out := &bytes.Buffer{}
+	var w io.Writer = out
+	if fn := action.OutputFrom(ctx); fn != nil {
+		lines := action.NewLineWriter(fn)
+		defer lines.Flush()
+		w = io.MultiWriter(out, lines)
+	}
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return out.Bytes(), ctx.Err()
+	}
+	return out.Bytes(), err
+}
@@ -0,0 +1,191 @@
+package testkit
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Cidan/pepper/action"
+	"github.com/Cidan/pepper/plan"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("testkit.update", false, "write the golden files of sandboxes instead of comparing them")
+
+// Binds are the host directories every sandbox mounts, so that
+// commands find the host's tools and libraries.
+var Binds = []string{"/bin", "/sbin", "/lib", "/lib32", "/lib64", "/usr", "/dev"}
+
+// Sandbox is a throwaway root filesystem for a test to apply plans
+// to. Every command is recorded by Fake, which answers the package
+// managers from Packages and runs the rest in the sandbox.
+type Sandbox struct {
+	Root     string
+	Fake     *Fake
+	Packages *Packages
+	t        testing.TB
+}
+
+var (
+	probe    sync.Once
+	probeErr error
+)
+
+// New returns an empty sandbox, removed once the test is over. The
+// test is skipped if the host does not allow unprivileged namespaces.
+func New(t testing.TB) *Sandbox {
+	t.Helper()
+	if !mainCalled {
+		t.Fatal("testkit: the test binary must call testkit.Main from TestMain")
+	}
+	probe.Do(func() {
+		_, probeErr = (&Namespace{Root: "/"}).Run(context.Background(), "true")
+	})
+	if probeErr != nil {
+		t.Skipf("testkit: unable to create namespaces: %s", probeErr)
+	}
+
+	root, err := ioutil.TempDir("", "pepper-testkit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+	for _, dir := range []string{"etc", "tmp", "var/lib/dpkg"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fake := NewFake(&Namespace{Root: root, Binds: Binds})
+	return &Sandbox{
+		Root:     root,
+		Fake:     fake,
+		Packages: fake.Packages(),
+		t:        t,
+	}
+}
+
+// Context returns a context for applying states to the sandbox
+func (s *Sandbox) Context() context.Context {
+	ctx := action.WithRoot(context.Background(), s.Root)
+	return action.WithRunner(ctx, s.Fake)
+}
+
+// Apply reads every state file in dir and executes the plan in the
+// sandbox. The test fails if the plan cannot be generated, while
+// failed states are left to the test to check in the report.
+func (s *Sandbox) Apply(dir string) *plan.Report {
+	s.t.Helper()
+	p := plan.New()
+	if err := p.ReadDir(dir); err != nil {
+		s.t.Fatal(err)
+	}
+	if err := p.Generate(); err != nil {
+		s.t.Fatal(err)
+	}
+	report, _ := p.Execute(s.Context())
+	return report
+}
+
+// WriteFile writes a file in the sandbox, creating its directory
+func (s *Sandbox) WriteFile(path, content string) {
+	s.t.Helper()
+	full := filepath.Join(s.Root, path)
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		s.t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(full, []byte(content), 0644); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// ReadFile returns the content of a file in the sandbox
+func (s *Sandbox) ReadFile(path string) string {
+	s.t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join(s.Root, path))
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return string(b)
+}
+
+// Snapshot describes the commands run so far and every file in the
+// sandbox, other than the host directories it mounts.
+func (s *Sandbox) Snapshot() string {
+	s.t.Helper()
+	var b strings.Builder
+	b.WriteString("commands:\n")
+	for _, c := range s.Fake.Commands() {
+		fmt.Fprintf(&b, "  %s\n", c)
+	}
+
+	b.WriteString("packages:\n")
+	for _, name := range s.Packages.Installed() {
+		fmt.Fprintf(&b, "  %s\n", name)
+	}
+
+	b.WriteString("files:\n")
+	binds := map[string]bool{}
+	for _, dir := range Binds {
+		binds[dir] = true
+	}
+	err := filepath.Walk(s.Root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := "/" + strings.TrimPrefix(path, s.Root+"/")
+		switch {
+		case binds[rel] && fi.IsDir():
+			return filepath.SkipDir
+		case binds[rel], fi.IsDir():
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&b, "  %s -> %s\n", rel, link)
+		default:
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&b, "  %s %s\n", rel, fi.Mode().Perm())
+			for _, line := range strings.SplitAfter(string(content), "\n") {
+				if line != "" {
+					fmt.Fprintf(&b, "    | %s", strings.TrimSuffix(line, "\n")+"\n")
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return b.String()
+}
+
+// Golden compares the snapshot of the sandbox with the golden file
+// testdata/<name>.golden. Run the test with -testkit.update to write
+// the golden file instead.
+func (s *Sandbox) Golden(name string) {
+	s.t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	got := s.Snapshot()
+	if *update {
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			s.t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		s.t.Fatalf("%s, run the test with -testkit.update to create it", err)
+	}
+	assert.Equal(s.t, string(want), got, "snapshot differs from %s", path)
+}
@@ -0,0 +1,14 @@
+shell run motd {
+  cmd  = "sh"
+  args = ["-c", "echo welcome > /etc/motd && chmod 600 /etc/motd"]
+}
+
+shell run whoami {
+  cmd  = "id"
+  args = ["-u"]
+}
+
+assert file_contains motd {
+  path = "/etc/motd"
+  text = "welcome"
+}
@@ -0,0 +1,148 @@
+/*
+Package testkit applies plans to a throwaway root filesystem, so that
+tests can check what states really do without touching the host.
+
+Commands run chrooted into the root, inside unprivileged user and
+mount namespaces where the host's tools and libraries are mounted read
+only. Commands that should not really run, such as package managers,
+are answered by a Fake runner, which records every command.
+
+Commands are started by running the test binary again inside the
+namespaces, so test binaries using a Sandbox must call Main from
+TestMain:
+
+	func TestMain(m *testing.M) {
+		testkit.Main(m)
+	}
+*/
+package testkit
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// Environment variables that tell the test binary it was started to
+// run a command in a sandbox.
+const (
+	rootEnv  = "PEPPER_TESTKIT_ROOT"
+	bindsEnv = "PEPPER_TESTKIT_BINDS"
+)
+
+// path is where commands are looked up in the sandbox
+const path = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// mainCalled is set once Main is running the tests
+var mainCalled bool
+
+// Main runs the tests, or the command the test binary was started to
+// run in a sandbox.
+func Main(m *testing.M) {
+	if root := os.Getenv(rootEnv); root != "" {
+		os.Exit(enter(root, filepath.SplitList(os.Getenv(bindsEnv)), os.Args[1:]))
+	}
+	mainCalled = true
+	os.Exit(m.Run())
+}
+
+// enter sets up the sandbox at root from inside the namespaces, and
+// replaces the test binary with the command. It only returns if the
+// command could not be started.
+func enter(root string, binds []string, args []string) int {
+	if err := isolate(root, binds); err != nil {
+		fmt.Fprintf(os.Stderr, "testkit: %s\n", err)
+		return 126
+	}
+
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, rootEnv+"=") && !strings.HasPrefix(kv, bindsEnv+"=") && !strings.HasPrefix(kv, "PATH=") {
+			env = append(env, kv)
+		}
+	}
+	env = append(env, "PATH="+path)
+	os.Setenv("PATH", path)
+	bin, err := exec.LookPath(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "testkit: %s\n", err)
+		return 127
+	}
+	err = syscall.Exec(bin, args, env)
+	fmt.Fprintf(os.Stderr, "testkit: %s: %s\n", args[0], err)
+	return 126
+}
+
+// isolate mounts the host directories binds in root and chroots into
+// it. Every bind is read only, except /dev so that commands can write
+// to /dev/null.
+func isolate(root string, binds []string) error {
+	// Keep the mounts from propagating back to the host
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("making mounts private: %s", err)
+	}
+	for _, dir := range binds {
+		if err := bind(root, dir, dir != "/dev"); err != nil {
+			return err
+		}
+	}
+	if err := syscall.Chroot(root); err != nil {
+		return fmt.Errorf("chroot %s: %s", root, err)
+	}
+	return os.Chdir("/")
+}
+
+// bind mounts the host directory dir at the same place in root.
+// Directories missing from the host are skipped, and symbolic links,
+// such as /bin on merged /usr systems, are copied as they are.
+func bind(root, dir string, readOnly bool) error {
+	fi, err := os.Lstat(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(root, dir)
+	if fi.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(dir)
+		if err != nil {
+			return err
+		}
+		os.Remove(target)
+		return os.Symlink(link, target)
+	}
+
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return err
+	}
+	if err := syscall.Mount(dir, target, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("mounting %s: %s", dir, err)
+	}
+	if !readOnly {
+		return nil
+	}
+	// Flags the host mounted dir with are locked in the namespace,
+	// and must be kept when remounting.
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return err
+	}
+	flags := uintptr(syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY)
+	flags |= uintptr(st.Flags) & (syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC | syscall.MS_NOATIME | syscall.MS_NODIRATIME)
+	if st.Flags&stRelatime != 0 {
+		flags |= syscall.MS_RELATIME
+	}
+	if err := syscall.Mount("", target, "", flags, ""); err != nil {
+		return fmt.Errorf("mounting %s read only: %s", dir, err)
+	}
+	return nil
+}
+
+// stRelatime is the statfs flag of mounts with relatime, which unlike
+// the other flags differs from its mount flag.
+const stRelatime = 0x1000
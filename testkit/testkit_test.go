@@ -0,0 +1,61 @@
+package testkit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Cidan/pepper/plan"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	Main(m)
+}
+
+func TestApplyExamples(t *testing.T) {
+	s := New(t)
+	s.Packages = s.Fake.Packages("htop")
+	report := s.Apply("../examples")
+	assert.Nil(t, report.Err())
+	s.Golden("examples")
+}
+
+func TestApplyFiles(t *testing.T) {
+	s := New(t)
+	s.WriteFile("/etc/motd", "hello\n")
+	report := s.Apply("testdata/files")
+	assert.Nil(t, report.Err())
+	assert.Equal(t, "welcome\n", s.ReadFile("/etc/motd"))
+
+	// Commands run as root in the sandbox
+	for _, r := range report.Results {
+		if r.Address == "shell.run.whoami" {
+			assert.Equal(t, "0\n", r.Output)
+		}
+	}
+	assert.Equal(t, plan.StatusOK, report.Results[len(report.Results)-1].Status)
+	s.Golden("files")
+}
+
+func TestFake(t *testing.T) {
+	f := NewFake(nil)
+	f.Handle("echo", func(args []string) ([]byte, error) {
+		return []byte(args[0] + "\n"), nil
+	})
+	out, err := f.Run(context.Background(), "echo", "hi")
+	assert.Nil(t, err)
+	assert.Equal(t, "hi\n", string(out))
+
+	_, err = f.Run(context.Background(), "rm", "-rf", "/")
+	assert.Error(t, err)
+	assert.Equal(t, []Command{
+		{Name: "echo", Args: []string{"hi"}},
+		{Name: "rm", Args: []string{"-rf", "/"}},
+	}, f.Commands())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = f.Run(ctx, "echo", "late")
+	assert.True(t, errors.Is(err, context.Canceled))
+}
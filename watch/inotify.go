@@ -0,0 +1,113 @@
+package watch
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// events are the inotify events that mean a file changed
+const events = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_CLOSE_WRITE |
+	syscall.IN_MODIFY | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ATTRIB
+
+// inotify is a Watcher using the kernel's inotify. Each directory has
+// its own watch, since inotify does not watch subdirectories. Reads go
+// through f, so that closing it stops them, while fd is kept for
+// adding watches without making f blocking.
+type inotify struct {
+	fd      int
+	f       *os.File
+	mu      sync.Mutex
+	watches map[int32]string
+	changes chan string
+	done    chan struct{}
+}
+
+// NewInotify returns a Watcher using inotify
+func NewInotify(dirs []string) (Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	w := &inotify{
+		fd:      fd,
+		f:       os.NewFile(uintptr(fd), "inotify"),
+		watches: map[int32]string{},
+		changes: make(chan string, 16),
+		done:    make(chan struct{}),
+	}
+	for _, dir := range dirs {
+		if err := w.add(dir); err != nil {
+			w.f.Close()
+			return nil, err
+		}
+	}
+	go w.read()
+	return w, nil
+}
+
+func (w *inotify) Changes() <-chan string {
+	return w.changes
+}
+
+func (w *inotify) Close() error {
+	close(w.done)
+	return w.f.Close()
+}
+
+// add watches dir and every directory under it
+func (w *inotify) add(dir string) error {
+	return filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.IsDir() {
+			return nil
+		}
+		wd, err := syscall.InotifyAddWatch(w.fd, path, events)
+		if err != nil {
+			return os.NewSyscallError("inotify_add_watch", err)
+		}
+		w.mu.Lock()
+		w.watches[int32(wd)] = path
+		w.mu.Unlock()
+		return nil
+	})
+}
+
+// read sends the path of every event until the watcher is closed
+func (w *inotify) read() {
+	defer close(w.changes)
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.f.Read(buf)
+		if err != nil {
+			return
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			name := buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(ev.Len)]
+			off += syscall.SizeofInotifyEvent + int(ev.Len)
+
+			w.mu.Lock()
+			path, ok := w.watches[ev.Wd]
+			w.mu.Unlock()
+			if !ok {
+				continue
+			}
+			if len(name) > 0 {
+				path = filepath.Join(path, string(bytes.TrimRight(name, "\x00")))
+			}
+			// New directories are watched too, along with anything
+			// created in them before the watch was added.
+			if ev.Mask&syscall.IN_ISDIR != 0 && ev.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+				w.add(path)
+			}
+			select {
+			case w.changes <- path:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
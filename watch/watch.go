@@ -0,0 +1,122 @@
+/*
+Package watch reports changes to the files under a set of
+directories, with inotify where the kernel allows it and by polling
+otherwise.
+*/
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Watcher sends the path of every file that changes under its
+// directories, including files created in new subdirectories.
+// Directories that do not exist are ignored.
+type Watcher interface {
+	// Changes is closed once the watcher is closed
+	Changes() <-chan string
+	Close() error
+}
+
+// New watches dirs with inotify, or by polling them every interval if
+// inotify cannot be used, e.g. because the host ran out of watches.
+func New(dirs []string, interval time.Duration) (Watcher, error) {
+	w, err := NewInotify(dirs)
+	if err == nil {
+		return w, nil
+	}
+	log.Warn().Err(err).Dur("interval", interval).Msg("Unable to use inotify, polling for changes")
+	return NewPoller(dirs, interval)
+}
+
+// poller is a Watcher that compares the files under its directories
+// every interval.
+type poller struct {
+	dirs    []string
+	files   map[string]os.FileInfo
+	changes chan string
+	done    chan struct{}
+}
+
+// NewPoller returns a Watcher that looks for changes every interval
+func NewPoller(dirs []string, interval time.Duration) (Watcher, error) {
+	p := &poller{
+		dirs:    dirs,
+		changes: make(chan string, 16),
+		done:    make(chan struct{}),
+	}
+	p.files = p.scan()
+	go p.poll(interval)
+	return p, nil
+}
+
+func (p *poller) Changes() <-chan string {
+	return p.changes
+}
+
+func (p *poller) Close() error {
+	close(p.done)
+	return nil
+}
+
+func (p *poller) poll(interval time.Duration) {
+	defer close(p.changes)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.done:
+			return
+		}
+		files := p.scan()
+		for path, fi := range files {
+			if old, ok := p.files[path]; !ok || changed(old, fi) {
+				if !p.send(path) {
+					return
+				}
+			}
+		}
+		for path := range p.files {
+			if _, ok := files[path]; !ok {
+				if !p.send(path) {
+					return
+				}
+			}
+		}
+		p.files = files
+	}
+}
+
+// send sends a change, and returns false if the poller was closed
+func (p *poller) send(path string) bool {
+	select {
+	case p.changes <- path:
+		return true
+	case <-p.done:
+		return false
+	}
+}
+
+// scan lists every file under the directories
+func (p *poller) scan() map[string]os.FileInfo {
+	files := map[string]os.FileInfo{}
+	for _, dir := range p.dirs {
+		filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+			if err == nil {
+				files[path] = fi
+			}
+			return nil
+		})
+	}
+	return files
+}
+
+// changed returns true if a file was modified between two scans
+func changed(a, b os.FileInfo) bool {
+	return !a.ModTime().Equal(b.ModTime()) || a.Size() != b.Size() || a.Mode() != b.Mode()
+}
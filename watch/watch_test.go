@@ -0,0 +1,65 @@
+package watch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// waitFor waits for a change of path, failing after a while
+func waitFor(t *testing.T, w Watcher, path string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case p := <-w.Changes():
+			if p == path {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("no change of %s", path)
+		}
+	}
+}
+
+func testWatcher(t *testing.T, newWatcher func(dirs []string) (Watcher, error)) {
+	dir, err := ioutil.TempDir("", "watch")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	w, err := newWatcher([]string{dir, filepath.Join(dir, "missing")})
+	assert.Nil(t, err)
+
+	file := filepath.Join(dir, "web.hcl")
+	assert.Nil(t, ioutil.WriteFile(file, []byte("a"), 0644))
+	waitFor(t, w, file)
+
+	// Files in new subdirectories are watched too
+	sub := filepath.Join(dir, "sub")
+	assert.Nil(t, os.Mkdir(sub, 0755))
+	time.Sleep(50 * time.Millisecond)
+	nested := filepath.Join(sub, "db.hcl")
+	assert.Nil(t, ioutil.WriteFile(nested, []byte("b"), 0644))
+	waitFor(t, w, nested)
+
+	assert.Nil(t, os.Remove(file))
+	waitFor(t, w, file)
+
+	assert.Nil(t, w.Close())
+	for range w.Changes() {
+	}
+}
+
+func TestInotify(t *testing.T) {
+	testWatcher(t, NewInotify)
+}
+
+func TestPoller(t *testing.T) {
+	testWatcher(t, func(dirs []string) (Watcher, error) {
+		return NewPoller(dirs, 10*time.Millisecond)
+	})
+}